@@ -17,17 +17,17 @@ limitations under the License.
 package elaservice
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/golang/glog"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/types"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -35,7 +35,6 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/workqueue"
 
 	"github.com/google/elafros/pkg/apis/ela/v1alpha1"
 	clientset "github.com/google/elafros/pkg/client/clientset/versioned"
@@ -44,6 +43,8 @@ import (
 	listers "github.com/google/elafros/pkg/client/listers/ela/v1alpha1"
 	"github.com/google/elafros/pkg/controller"
 	"github.com/google/elafros/pkg/controller/util"
+	"github.com/google/elafros/pkg/reconciler"
+	"github.com/google/elafros/pkg/traffic"
 )
 
 var serviceKind = v1alpha1.SchemeGroupVersion.WithKind("ElaService")
@@ -62,47 +63,60 @@ const (
 	MessageResourceSynced = "ElaService synced successfully"
 )
 
-// RevisionRoute represents a single target to route to.
-// Basically represents a k8s service representing a specific Revision
-// and how much of the traffic goes to it.
-type RevisionRoute struct {
-	Service string
-	Weight  int
-}
-
 // +controller:group=ela,version=v1alpha1,kind=ElaService,resource=elaservices
 type ElaServiceControllerImpl struct {
 	// kubeclientset is a standard kubernetes clientset
-	kubeclientset  kubernetes.Interface
-	elaclientset clientset.Interface
+	kubeclientset kubernetes.Interface
+	elaclientset  clientset.Interface
 
 	// lister indexes properties about RevisionTemplate
 	lister listers.ElaServiceLister
 	synced cache.InformerSynced
 
-	// workqueue is a rate limited work queue. This is used to queue work to be
-	// processed instead of performing it as soon as a change happens. This
-	// means we can ensure we only process a fixed amount of resources at a
-	// time, and makes it easy to ensure we are never processing the same item
-	// simultaneously in two different workers.
-	workqueue workqueue.RateLimitingInterface
+	// manager owns the workqueue and worker pool, and dispatches dequeued
+	// keys to our Reconcile method. See pkg/reconciler.
+	manager *reconciler.Manager
+
+	// scaler dynamically sizes manager's worker pool based on how many
+	// controller replicas are currently running. See scaler.go.
+	scaler *ControllerScaler
+
+	// router reconciles the weighted RevisionRoutes computed from an
+	// ElaService's traffic targets onto whichever service-mesh backend
+	// this cluster uses. See pkg/traffic.
+	router traffic.TrafficRouter
+
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
 }
 
+const (
+	// controllerNamespace is where each replica's membership Lease lives.
+	controllerNamespace = "ela-system"
+	// workBudget is the total worker count to divide across all replicas.
+	workBudget = 20
+	// scalerPollPeriod is how often the ControllerScaler re-checks replica count.
+	scalerPollPeriod = 15 * time.Second
+)
+
 // Init initializes the controller and is called by the generated code
 // Registers eventhandlers to enqueue events
 // config - client configuration for talking to the apiserver
 // si - informer factory shared across all controllers for listening to events and indexing resource properties
 // reconcileKey - function for mapping queue keys to resource names
-//TODO(vaikas): somewhat generic (generic behavior)
+// routerKind selects which traffic.TrafficRouter backend reconciles traffic
+// splits; pass "" for the default (Istio). gatewayClient is only required
+// when routerKind is traffic.GatewayAPI; callers using any other kind may
+// pass nil.
 func NewController(
 	kubeclientset kubernetes.Interface,
 	elaclientset clientset.Interface,
 	kubeInformerFactory kubeinformers.SharedInformerFactory,
 	elaInformerFactory informers.SharedInformerFactory,
-	config *rest.Config) controller.Interface {
+	config *rest.Config,
+	routerKind traffic.Kind,
+	gatewayClient traffic.GatewayAPIClient) (controller.Interface, error) {
 
 	log.Printf("ElaService controller Init")
 
@@ -119,160 +133,59 @@ func NewController(
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
-	controller := &ElaServiceControllerImpl{
-		kubeclientset:  kubeclientset,
-		elaclientset: elaclientset,
-		lister:         informer.Lister(),
-		synced:         informer.Informer().HasSynced,
-		workqueue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ElaServices"),
-		recorder:       recorder,
-	}
-
-	glog.Info("Setting up event handlers")
-	// Set up an event handler for when RevisionTemplate resources change
-	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.enqueueElaService,
-		UpdateFunc: func(old, new interface{}) {
-			controller.enqueueElaService(new)
-		},
-	})
-
-	return controller
-
-}
-
-// Run will set up the event handlers for types we are interested in, as well
-// as syncing informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
-//TODO(grantr): generic
-func (c *ElaServiceControllerImpl) Run(threadiness int, stopCh <-chan struct{}) error {
-	defer runtime.HandleCrash()
-	defer c.workqueue.ShutDown()
-
-	// Start the informer factories to begin populating the informer caches
-	glog.Info("Starting ElaService controller")
-
-	// Wait for the caches to be synced before starting workers
-	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.synced); !ok {
-		return fmt.Errorf("failed to wait for caches to sync")
-	}
-
-	glog.Info("Starting workers")
-	// Launch two workers to process Foo resources
-	for i := 0; i < threadiness; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
-	}
-
-	glog.Info("Started workers")
-	<-stopCh
-	glog.Info("Shutting down workers")
-
-	return nil
-}
-
-// runWorker is a long-running function that will continually call the
-// processNextWorkItem function in order to read and process a message on the
-// workqueue.
-//TODO(grantr): generic
-func (c *ElaServiceControllerImpl) runWorker() {
-	for c.processNextWorkItem() {
+	router, err := traffic.New(routerKind, traffic.Dependencies{ElaClient: elaclientset, GatewayClient: gatewayClient})
+	if err != nil {
+		return nil, err
 	}
-}
 
-// processNextWorkItem will read a single work item off the workqueue and
-// attempt to process it, by calling the syncHandler.
-//TODO(grantr): generic
-func (c *ElaServiceControllerImpl) processNextWorkItem() bool {
-	obj, shutdown := c.workqueue.Get()
-
-	if shutdown {
-		return false
+	c := &ElaServiceControllerImpl{
+		kubeclientset: kubeclientset,
+		elaclientset:  elaclientset,
+		lister:        informer.Lister(),
+		synced:        informer.Informer().HasSynced,
+		recorder:      recorder,
+		router:        router,
 	}
 
-	// We wrap this block in a func so we can defer c.workqueue.Done.
-	err := func(obj interface{}) error {
-		// We call Done here so the workqueue knows we have finished
-		// processing this item. We also must remember to call Forget if we
-		// do not want this work item being re-queued. For example, we do
-		// not call Forget if a transient error occurs, instead the item is
-		// put back on the workqueue and attempted again after a back-off
-		// period.
-		defer c.workqueue.Done(obj)
-		var key string
-		var ok bool
-		// We expect strings to come off the workqueue. These are of the
-		// form namespace/name. We do this as the delayed nature of the
-		// workqueue means the items in the informer cache may actually be
-		// more up to date that when the item was initially put onto the
-		// workqueue.
-		if key, ok = obj.(string); !ok {
-			// As the item in the workqueue is actually invalid, we call
-			// Forget here else we'd go into a loop of attempting to
-			// process a work item that is invalid.
-			c.workqueue.Forget(obj)
-			runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
-			return nil
-		}
-		// Run the syncHandler, passing it the namespace/name string of the
-		// Foo resource to be synced.
-		if err := c.syncHandler(key); err != nil {
-			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
-		}
-		// Finally, if no error occurs we Forget this item so it does not
-		// get queued again until another change happens.
-		c.workqueue.Forget(obj)
-		glog.Infof("Successfully synced '%s'", key)
-		return nil
-	}(obj)
+	glog.Info("Setting up event handlers")
+	c.manager = reconciler.NewManager("ElaServices", c)
+	c.manager.Watch(informer.Informer())
 
+	identity, err := os.Hostname()
 	if err != nil {
-		runtime.HandleError(err)
-		return true
+		identity = fmt.Sprintf("elaservice-controller-%d", time.Now().UnixNano())
 	}
+	counter := NewCachedServerCounter(
+		NewLeaseBasedCounter(kubeclientset, controllerNamespace, identity, 2*scalerPollPeriod),
+		defaultCacheTTL)
+	c.scaler = NewControllerScaler(c.manager, counter, workBudget, scalerPollPeriod)
 
-	return true
+	return c, nil
 }
 
-// enqueueElaService takes a ElaService resource and
-// converts it into a namespace/name string which is then put onto the work
-// queue. This method should *not* be passed resources of any type other than
-// ElaService.
-//TODO(grantr): generic
-func (c *ElaServiceControllerImpl) enqueueElaService(obj interface{}) {
-	var key string
-	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
-		runtime.HandleError(err)
-		return
+// Run hands off to the generic reconciler.Manager to sync informer caches,
+// then lets the ControllerScaler size and resize the worker pool based on
+// how many controller replicas are currently alive, until stopCh is closed.
+func (c *ElaServiceControllerImpl) Run(threadiness int, stopCh <-chan struct{}) error {
+	if err := c.manager.WaitForCacheSync(stopCh, c.synced); err != nil {
+		return err
 	}
-	c.workqueue.AddRateLimited(key)
+	c.scaler.Run(stopCh)
+	return nil
 }
 
-// syncHandler compares the actual state with the desired, and attempts to
-// converge the two. It then updates the Status block of the Foo resource
-// with the current status of the resource.
-//TODO(grantr): not generic
-func (c *ElaServiceControllerImpl) syncHandler(key string) error {
-	// Convert the namespace/name string into a distinct namespace and name
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
-		return nil
-	}
-
+// Reconcile compares the actual state with the desired state for the
+// ElaService named by req, and attempts to converge the two.
+func (c *ElaServiceControllerImpl) Reconcile(ctx context.Context, req types.NamespacedName) (reconciler.Result, error) {
 	// Get the ElaService resource with this namespace/name
-	es, err := c.lister.ElaServices(namespace).Get(name)
+	es, err := c.lister.ElaServices(req.Namespace).Get(req.Name)
 	if err != nil {
-		// The resource may no longer exist, in which case we stop
-		// processing.
-		if errors.IsNotFound(err) {
-			runtime.HandleError(fmt.Errorf("elaservice '%s' in work queue no longer exists", key))
-			return nil
+		// The resource may no longer exist, in which case we stop processing.
+		if apierrs.IsNotFound(err) {
+			glog.Warningf("elaservice %q in work queue no longer exists", req)
+			return reconciler.Result{}, nil
 		}
-
-		return err
+		return reconciler.Result{}, err
 	}
 
 	glog.Infof("Running reconcile ElaService for %s\n%+v\n", es.Name, es)
@@ -283,31 +196,28 @@ func (c *ElaServiceControllerImpl) syncHandler(key string) error {
 	// This is one way to implement the 0->1. For now, we'll just create a placeholder
 	// that selects nothing.
 	log.Printf("Creating/Updating placeholder k8s services")
-	err = c.createPlaceholderService(es, namespace)
-	if err != nil {
-		return err
+	if err := c.createPlaceholderService(es, req.Namespace); err != nil {
+		return reconciler.Result{}, err
 	}
 
 	// Then create the Ingress rule for this service
 	log.Printf("Creating or updating ingress rule")
-	err = c.createOrUpdateIngress(es, namespace)
-	if err != nil {
+	if err := c.createOrUpdateIngress(es, req.Namespace); err != nil {
 		if !apierrs.IsAlreadyExists(err) {
 			log.Printf("Failed to create ingress rule: %s", err)
-			return err
+			return reconciler.Result{}, err
 		}
 	}
 
 	// Then create the actual route rules.
 	log.Printf("Creating istio route rules")
-	err = c.createOrUpdateRoutes(es, namespace)
-	if err != nil {
+	if err := c.createOrUpdateRoutes(ctx, es, req.Namespace); err != nil {
 		log.Printf("Failed to create Routes: %s", err)
-		return err
+		return reconciler.Result{}, err
 	}
 
 	c.recorder.Event(es, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
-	return nil
+	return reconciler.Result{}, nil
 }
 
 func (c *ElaServiceControllerImpl) createPlaceholderService(u *v1alpha1.ElaService, ns string) error {
@@ -349,9 +259,9 @@ func (c *ElaServiceControllerImpl) createOrUpdateIngress(es *v1alpha1.ElaService
 	return nil
 }
 
-func (c *ElaServiceControllerImpl) getRoutes(u *v1alpha1.ElaService) ([]RevisionRoute, error) {
+func (c *ElaServiceControllerImpl) getRoutes(u *v1alpha1.ElaService) ([]traffic.RevisionRoute, error) {
 	log.Printf("Figuring out routes for ElaService: %s", u.Name)
-	ret := []RevisionRoute{}
+	ret := []traffic.RevisionRoute{}
 	for _, tt := range u.Spec.Rollout.Traffic {
 		rr, err := c.getRouteForTrafficTarget(tt, u.Namespace)
 		if err != nil {
@@ -363,7 +273,7 @@ func (c *ElaServiceControllerImpl) getRoutes(u *v1alpha1.ElaService) ([]Revision
 	return ret, nil
 }
 
-func (c *ElaServiceControllerImpl) getRouteForTrafficTarget(tt v1alpha1.TrafficTarget, ns string) (RevisionRoute, error) {
+func (c *ElaServiceControllerImpl) getRouteForTrafficTarget(tt v1alpha1.TrafficTarget, ns string) (traffic.RevisionRoute, error) {
 	elaNS := util.GetElaNamespaceName(ns)
 	// If template specified, fetch last revision otherwise use Revision
 	revisionName := tt.Revision
@@ -371,7 +281,7 @@ func (c *ElaServiceControllerImpl) getRouteForTrafficTarget(tt v1alpha1.TrafficT
 		rtClient := c.elaclientset.ElafrosV1alpha1().RevisionTemplates(ns)
 		rt, err := rtClient.Get(tt.RevisionTemplate, metav1.GetOptions{})
 		if err != nil {
-			return RevisionRoute{}, err
+			return traffic.RevisionRoute{}, err
 		}
 		revisionName = rt.Status.Latest
 	}
@@ -379,47 +289,19 @@ func (c *ElaServiceControllerImpl) getRouteForTrafficTarget(tt v1alpha1.TrafficT
 	rev, err := prClient.Get(revisionName, metav1.GetOptions{})
 	if err != nil {
 		log.Printf("Failed to fetch Revision: %s : %s", revisionName, err)
-		return RevisionRoute{}, err
+		return traffic.RevisionRoute{}, err
 	}
-	return RevisionRoute{Service: fmt.Sprintf("%s.%s", rev.Status.ServiceName, elaNS), Weight: tt.Percent}, nil
+	return traffic.RevisionRoute{Service: fmt.Sprintf("%s.%s", rev.Status.ServiceName, elaNS), Weight: tt.Percent}, nil
 }
 
-func (c *ElaServiceControllerImpl) createOrUpdateRoutes(u *v1alpha1.ElaService, ns string) error {
-	// grab a client that's specific to RouteRule.
-	routeClient := c.elaclientset.ConfigV1alpha2().RouteRules(ns)
-	if routeClient == nil {
-		log.Printf("Failed to create resource client")
-		return fmt.Errorf("Couldn't get a routeClient")
-	}
-
+// createOrUpdateRoutes computes the desired weighted RevisionRoutes for u
+// and hands them to c.router, which reconciles them onto whatever
+// service-mesh backend this cluster is configured with (see pkg/traffic).
+func (c *ElaServiceControllerImpl) createOrUpdateRoutes(ctx context.Context, u *v1alpha1.ElaService, ns string) error {
 	routes, err := c.getRoutes(u)
 	if err != nil {
 		log.Printf("Failed to get routes for %s : %q", u.Name, err)
 		return err
 	}
-	if len(routes) == 0 {
-		log.Printf("No routes were found for the service %q", u.Name)
-		return nil
-	}
-	for _, r := range routes {
-		log.Printf("Adding a route to %q Weight: %d", r.Service, r.Weight)
-	}
-
-	routeRuleName := util.GetElaIstioRouteRuleName(u)
-	routeRules, err := routeClient.Get(routeRuleName, metav1.GetOptions{})
-	if err != nil {
-		if !apierrs.IsNotFound(err) {
-			return err
-		}
-		routeRules = MakeElaServiceIstioRoutes(u, ns, routes)
-		_, createErr := routeClient.Create(routeRules)
-		return createErr
-	}
-
-	routeRules.Spec = MakeElaServiceIstioSpec(u, ns, routes)
-	_, err = routeClient.Update(routeRules)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.router.Reconcile(ctx, u, routes)
 }
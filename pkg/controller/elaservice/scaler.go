@@ -0,0 +1,263 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package elaservice
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// membersLeaseName is the well-known Lease name each controller replica
+	// renews its own identity under, so peers can count live replicas.
+	membersLeaseName = "elaservice-controller-members"
+
+	defaultCacheTTL = 10 * time.Second
+)
+
+var controllerReplicaCount = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "elafros",
+	Subsystem: "elaservice_controller",
+	Name:      "replica_count",
+	Help:      "Number of elaservice-controller replicas currently counted via coordination.k8s.io Leases.",
+})
+
+func init() {
+	prometheus.MustRegister(controllerReplicaCount)
+}
+
+// ServerCounter reports how many replicas of this controller are currently
+// running, so Run can size its worker pool as a fair share of a global work
+// budget rather than always spawning a fixed number of workers.
+type ServerCounter interface {
+	CountServers() (int, error)
+}
+
+// LeaseBasedCounter counts replicas by listing non-expired
+// coordination.k8s.io/v1 Leases labelled app=<membersLeaseName> in its
+// namespace, and renewing this replica's own Lease on every call.
+type LeaseBasedCounter struct {
+	client    kubernetes.Interface
+	namespace string
+	identity  string
+	duration  time.Duration
+}
+
+// NewLeaseBasedCounter returns a ServerCounter that creates/renews a Lease
+// named "<membersLeaseName>-<identity>" in namespace on every CountServers
+// call, with the given lease duration.
+func NewLeaseBasedCounter(client kubernetes.Interface, namespace, identity string, duration time.Duration) *LeaseBasedCounter {
+	return &LeaseBasedCounter{client: client, namespace: namespace, identity: identity, duration: duration}
+}
+
+// CountServers renews this replica's own Lease, then lists all member Leases
+// in the namespace and returns how many have not yet expired. A Lease is
+// considered expired once RenewTime + LeaseDurationSeconds < now.
+func (c *LeaseBasedCounter) CountServers() (int, error) {
+	if err := c.renew(); err != nil {
+		return 0, err
+	}
+
+	leases, err := c.client.CoordinationV1().Leases(c.namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app=%s", membersLeaseName),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	now := metav1.Now()
+	count := 0
+	for i := range leases.Items {
+		l := &leases.Items[i]
+		if l.Spec.RenewTime == nil || l.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := l.Spec.RenewTime.Add(time.Duration(*l.Spec.LeaseDurationSeconds) * time.Second)
+		if expiry.Before(now.Time) {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (c *LeaseBasedCounter) leaseName() string {
+	return fmt.Sprintf("%s-%s", membersLeaseName, c.identity)
+}
+
+func (c *LeaseBasedCounter) renew() error {
+	now := metav1.NowMicro()
+	durationSeconds := int32(c.duration.Seconds())
+	leases := c.client.CoordinationV1().Leases(c.namespace)
+
+	lease, err := leases.Get(c.leaseName(), metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.leaseName(),
+				Namespace: c.namespace,
+				Labels:    map[string]string{"app": membersLeaseName},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &c.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				RenewTime:            &now,
+			},
+		}
+		_, err = leases.Create(lease)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &c.identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(lease)
+	return err
+}
+
+// CachedServerCounter wraps a ServerCounter and memoizes its result for ttl,
+// refreshing lazily the next time CountServers is called after ttl elapses.
+// It deliberately does not use a background goroutine, so it's safe to wrap
+// around a short-lived process.
+type CachedServerCounter struct {
+	inner ServerCounter
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	lastAt   time.Time
+	lastVal  int
+	lastErr  error
+	hasValue bool
+}
+
+// NewCachedServerCounter wraps inner, caching its result for ttl. If ttl is
+// zero, defaultCacheTTL (10s) is used.
+func NewCachedServerCounter(inner ServerCounter, ttl time.Duration) *CachedServerCounter {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &CachedServerCounter{inner: inner, ttl: ttl}
+}
+
+// CountServers returns the cached count if it's younger than ttl, else
+// refreshes it by calling the wrapped counter.
+func (c *CachedServerCounter) CountServers() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hasValue && time.Since(c.lastAt) < c.ttl {
+		return c.lastVal, c.lastErr
+	}
+
+	c.lastVal, c.lastErr = c.inner.CountServers()
+	c.lastAt = time.Now()
+	c.hasValue = true
+	return c.lastVal, c.lastErr
+}
+
+// ControllerScaler dynamically sizes a reconciler.Manager's worker pool so
+// each replica takes roughly 1/N of a fixed global work budget, where N is
+// the live replica count reported by a ServerCounter.
+type ControllerScaler struct {
+	manager    managerWorkerPool
+	counter    ServerCounter
+	workBudget int
+	pollPeriod time.Duration
+
+	mu      sync.Mutex
+	workers []chan struct{} // one stop channel per currently-running worker
+}
+
+// managerWorkerPool is the subset of reconciler.Manager's API the scaler
+// needs; satisfied by *reconciler.Manager.
+type managerWorkerPool interface {
+	AddWorker(stopCh <-chan struct{})
+}
+
+// NewControllerScaler returns a ControllerScaler that keeps manager's worker
+// pool sized to workBudget/CountServers(), re-checking every pollPeriod.
+func NewControllerScaler(manager managerWorkerPool, counter ServerCounter, workBudget int, pollPeriod time.Duration) *ControllerScaler {
+	return &ControllerScaler{manager: manager, counter: counter, workBudget: workBudget, pollPeriod: pollPeriod}
+}
+
+// Run grows and shrinks the worker pool until stopCh is closed, then drains
+// every worker it started.
+func (s *ControllerScaler) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(s.pollPeriod)
+	defer ticker.Stop()
+
+	s.rescale()
+	for {
+		select {
+		case <-ticker.C:
+			s.rescale()
+		case <-stopCh:
+			s.drainAll()
+			return
+		}
+	}
+}
+
+func (s *ControllerScaler) rescale() {
+	count, err := s.counter.CountServers()
+	if err != nil {
+		glog.Warningf("ControllerScaler: failed to count servers, leaving pool as-is: %v", err)
+		return
+	}
+	if count < 1 {
+		count = 1
+	}
+	want := s.workBudget / count
+	if want < 1 {
+		want = 1
+	}
+	controllerReplicaCount.Set(float64(count))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.workers) < want {
+		stop := make(chan struct{})
+		s.manager.AddWorker(stop)
+		s.workers = append(s.workers, stop)
+	}
+	for len(s.workers) > want {
+		last := s.workers[len(s.workers)-1]
+		close(last)
+		s.workers = s.workers[:len(s.workers)-1]
+	}
+	glog.V(2).Infof("ControllerScaler: %d replicas, %d workers (budget %d)", count, len(s.workers), s.workBudget)
+}
+
+func (s *ControllerScaler) drainAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stop := range s.workers {
+		close(stop)
+	}
+	s.workers = nil
+}
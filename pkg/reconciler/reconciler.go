@@ -0,0 +1,223 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reconciler provides a small, generic controller-runtime-style
+// harness: a Manager owns the informers, workqueue, and worker pool, and
+// hands each dequeued key to a caller-supplied Reconciler. This removes the
+// workqueue/informer/processNextWorkItem boilerplate that used to be
+// duplicated in every one of our hand-rolled controllers.
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Result controls whether and when a request should be requeued after a
+// successful Reconcile call. A non-nil error from Reconcile always requeues
+// with backoff, regardless of Result.
+type Result struct {
+	// Requeue tells the Manager to put the request back on the queue
+	// immediately (subject to normal rate limiting).
+	Requeue bool
+	// RequeueAfter, if non-zero, requeues the request after the given delay
+	// instead of immediately. Implies Requeue.
+	RequeueAfter time.Duration
+}
+
+// Reconciler converges the observed state of the object named by req towards
+// its desired state. Implementations should be idempotent: Reconcile may be
+// called multiple times for the same object, including after it no longer
+// exists.
+type Reconciler interface {
+	Reconcile(ctx context.Context, req types.NamespacedName) (Result, error)
+}
+
+// Manager owns a single workqueue and worker pool for one Reconciler. It
+// watches one primary informer (via Watch) and, optionally, additional
+// "child" informers (via WatchChild) whose updates should re-enqueue the
+// owning object rather than themselves.
+type Manager struct {
+	name       string
+	reconciler Reconciler
+	queue      workqueue.RateLimitingInterface
+}
+
+// NewManager creates a Manager that dispatches dequeued keys to reconciler.
+// name is used for the workqueue name and log lines.
+func NewManager(name string, reconciler Reconciler) *Manager {
+	return &Manager{
+		name:       name,
+		reconciler: reconciler,
+		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name),
+	}
+}
+
+// Watch registers informer's Add/Update/Delete events to enqueue the changed
+// object itself.
+func (m *Manager) Watch(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    m.enqueue,
+		UpdateFunc: func(_, new interface{}) { m.enqueue(new) },
+		DeleteFunc: m.enqueueDeleted,
+	})
+}
+
+// WatchChild registers informer's Add/Update/Delete events to enqueue the
+// *owning* object, as identified by owningKey. This is how child Services,
+// Ingresses, and RouteRules trigger a re-reconcile of their parent.
+func (m *Manager) WatchChild(informer cache.SharedIndexInformer, owningKey func(obj interface{}) (types.NamespacedName, bool)) {
+	enqueueOwner := func(obj interface{}) {
+		if nsName, ok := owningKey(obj); ok {
+			m.queue.AddRateLimited(nsName.String())
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueueOwner,
+		UpdateFunc: func(_, new interface{}) { enqueueOwner(new) },
+		DeleteFunc: enqueueOwner,
+	})
+}
+
+func (m *Manager) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	m.queue.AddRateLimited(key)
+}
+
+// enqueueDeleted is like enqueue, but for DeleteFunc handlers: on a missed
+// delete event or an informer resync, client-go delivers a
+// cache.DeletedFinalStateUnknown tombstone instead of the object itself.
+// cache.MetaNamespaceKeyFunc doesn't know how to unwrap that, so it would log
+// an error and drop the deletion instead of reconciling it.
+func (m *Manager) enqueueDeleted(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	m.queue.AddRateLimited(key)
+}
+
+// WaitForCacheSync blocks until every one of cacheSyncs reports synced, or
+// stopCh is closed. Callers that need to dynamically resize the
+// worker pool (see AddWorker) should call this once before doing so, instead
+// of going through Start.
+func (m *Manager) WaitForCacheSync(stopCh <-chan struct{}, cacheSyncs ...cache.InformerSynced) error {
+	glog.Info("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(stopCh, cacheSyncs...); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+	return nil
+}
+
+// AddWorker starts a single worker goroutine that pulls from the shared
+// workqueue until stopCh is closed. It is the building block Start uses for
+// a fixed-size pool, and that a ControllerScaler can call directly to grow
+// or shrink the pool at runtime: closing stopCh drains that one worker
+// without affecting the others. stopCh is checked between work items, so a
+// worker finishes the item it is processing before it exits; a worker
+// waiting on an empty queue exits after processing the next item it gets.
+func (m *Manager) AddWorker(stopCh <-chan struct{}) {
+	go wait.Until(func() { m.runWorker(stopCh) }, time.Second, stopCh)
+}
+
+// Start runs threadiness workers until stopCh is closed, then shuts down the
+// workqueue and returns; it does not wait for work items still in progress.
+func (m *Manager) Start(threadiness int, stopCh <-chan struct{}, cacheSyncs ...cache.InformerSynced) error {
+	defer runtime.HandleCrash()
+	defer m.queue.ShutDown()
+
+	glog.Infof("Starting %s controller", m.name)
+	if err := m.WaitForCacheSync(stopCh, cacheSyncs...); err != nil {
+		return err
+	}
+
+	glog.Infof("Starting %d workers", threadiness)
+	for i := 0; i < threadiness; i++ {
+		m.AddWorker(stopCh)
+	}
+
+	<-stopCh
+	glog.Infof("Shutting down %s workers", m.name)
+	return nil
+}
+
+func (m *Manager) runWorker(stopCh <-chan struct{}) {
+	for m.processNextWorkItem() {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+	}
+}
+
+func (m *Manager) processNextWorkItem() bool {
+	obj, shutdown := m.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer m.queue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		m.queue.Forget(obj)
+		runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+
+	if err := m.reconcile(key); err != nil {
+		runtime.HandleError(fmt.Errorf("error syncing %q: %s, requeuing", key, err.Error()))
+		m.queue.AddRateLimited(key)
+		return true
+	}
+
+	m.queue.Forget(key)
+	return true
+}
+
+func (m *Manager) reconcile(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+
+	result, err := m.reconciler.Reconcile(context.Background(), types.NamespacedName{Namespace: namespace, Name: name})
+	if err != nil {
+		return err
+	}
+	if result.Requeue || result.RequeueAfter > 0 {
+		if result.RequeueAfter > 0 {
+			m.queue.AddAfter(key, result.RequeueAfter)
+		} else {
+			m.queue.AddRateLimited(key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package traffic
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	gatewayv1alpha2 "github.com/google/elafros/pkg/apis/gateway/v1alpha2"
+	"github.com/google/elafros/pkg/apis/ela/v1alpha1"
+)
+
+// GatewayAPIClient is the subset of a gateway.networking.k8s.io clientset
+// that gatewayAPIRouter needs. It's its own interface (rather than a
+// concrete generated clientset type) so that NewController does not depend
+// on a generated Gateway API clientset; this package still imports the
+// Gateway API types themselves.
+type GatewayAPIClient interface {
+	HTTPRoutes(namespace string) GatewayHTTPRouteInterface
+}
+
+// GatewayHTTPRouteInterface is the generated-client-shaped CRUD surface for
+// HTTPRoutes, mirroring the RouteRules interface istioRouter already
+// depends on.
+type GatewayHTTPRouteInterface interface {
+	Get(name string, opts metav1.GetOptions) (*gatewayv1alpha2.HTTPRoute, error)
+	Create(route *gatewayv1alpha2.HTTPRoute) (*gatewayv1alpha2.HTTPRoute, error)
+	Update(route *gatewayv1alpha2.HTTPRoute) (*gatewayv1alpha2.HTTPRoute, error)
+	Delete(name string, opts *metav1.DeleteOptions) error
+}
+
+// gatewayAPIRouter is a TrafficRouter backend for clusters that run the
+// Gateway API instead of Istio's config.istio.io CRDs.
+type gatewayAPIRouter struct {
+	client GatewayAPIClient
+}
+
+// NewGatewayAPIRouter returns a TrafficRouter that manages
+// gateway.networking.k8s.io HTTPRoutes.
+func NewGatewayAPIRouter(client GatewayAPIClient) TrafficRouter {
+	return &gatewayAPIRouter{client: client}
+}
+
+func (r *gatewayAPIRouter) Reconcile(ctx context.Context, es *v1alpha1.ElaService, routes []RevisionRoute) error {
+	routeClient := r.client.HTTPRoutes(es.Namespace)
+	if routeClient == nil {
+		log.Printf("Failed to create resource client")
+		return fmt.Errorf("couldn't get an HTTPRoute client")
+	}
+
+	if len(routes) == 0 {
+		log.Printf("No routes were found for the service %q", es.Name)
+		return nil
+	}
+
+	routeName := es.Name
+	httpRoute, err := routeClient.Get(routeName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrs.IsNotFound(err) {
+			return err
+		}
+		httpRoute = makeHTTPRoute(es, routeName, routes)
+		_, createErr := routeClient.Create(httpRoute)
+		return createErr
+	}
+
+	httpRoute.Spec = makeHTTPRouteSpec(routes)
+	_, err = routeClient.Update(httpRoute)
+	return err
+}
+
+func (r *gatewayAPIRouter) Delete(ctx context.Context, nsName types.NamespacedName) error {
+	routeClient := r.client.HTTPRoutes(nsName.Namespace)
+	err := routeClient.Delete(nsName.Name, &metav1.DeleteOptions{})
+	if apierrs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func makeHTTPRouteSpec(routes []RevisionRoute) gatewayv1alpha2.HTTPRouteSpec {
+	spec := gatewayv1alpha2.HTTPRouteSpec{
+		Rules: []gatewayv1alpha2.HTTPRouteRule{{
+			BackendRefs: make([]gatewayv1alpha2.HTTPBackendRef, 0, len(routes)),
+		}},
+	}
+	for _, rt := range routes {
+		spec.Rules[0].BackendRefs = append(spec.Rules[0].BackendRefs, gatewayv1alpha2.HTTPBackendRef{
+			Name:   rt.Service,
+			Weight: rt.Weight,
+		})
+	}
+	return spec
+}
+
+func makeHTTPRoute(es *v1alpha1.ElaService, name string, routes []RevisionRoute) *gatewayv1alpha2.HTTPRoute {
+	serviceRef := metav1.NewControllerRef(es, v1alpha1.SchemeGroupVersion.WithKind("ElaService"))
+	return &gatewayv1alpha2.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       es.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*serviceRef},
+		},
+		Spec: makeHTTPRouteSpec(routes),
+	}
+}
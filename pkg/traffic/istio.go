@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package traffic
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	configv1alpha2 "github.com/google/elafros/pkg/apis/config/v1alpha2"
+	"github.com/google/elafros/pkg/apis/ela/v1alpha1"
+	elaclientset "github.com/google/elafros/pkg/client/clientset/versioned"
+	"github.com/google/elafros/pkg/controller/util"
+)
+
+// istioRouter is the long-standing TrafficRouter backend, wired directly to
+// Istio v1alpha2 RouteRules. This is the same logic that used to live
+// in-line in the elaservice controller's createOrUpdateRoutes.
+type istioRouter struct {
+	client elaclientset.Interface
+}
+
+// NewIstioRouter returns a TrafficRouter that manages Istio v1alpha2
+// RouteRules.
+func NewIstioRouter(client elaclientset.Interface) TrafficRouter {
+	return &istioRouter{client: client}
+}
+
+func (r *istioRouter) Reconcile(ctx context.Context, es *v1alpha1.ElaService, routes []RevisionRoute) error {
+	routeClient := r.client.ConfigV1alpha2().RouteRules(es.Namespace)
+	if routeClient == nil {
+		log.Printf("Failed to create resource client")
+		return fmt.Errorf("couldn't get a routeClient")
+	}
+
+	if len(routes) == 0 {
+		log.Printf("No routes were found for the service %q", es.Name)
+		return nil
+	}
+	for _, rt := range routes {
+		log.Printf("Adding a route to %q Weight: %d", rt.Service, rt.Weight)
+	}
+
+	routeRuleName := util.GetElaIstioRouteRuleName(es)
+	routeRules, err := routeClient.Get(routeRuleName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrs.IsNotFound(err) {
+			return err
+		}
+		routeRules = makeIstioRouteRules(es, routeRuleName, routes)
+		_, createErr := routeClient.Create(routeRules)
+		return createErr
+	}
+
+	routeRules.Spec = makeIstioRouteRuleSpec(routes)
+	_, err = routeClient.Update(routeRules)
+	return err
+}
+
+func (r *istioRouter) Delete(ctx context.Context, nsName types.NamespacedName) error {
+	routeClient := r.client.ConfigV1alpha2().RouteRules(nsName.Namespace)
+	err := routeClient.Delete(nsName.Name, &metav1.DeleteOptions{})
+	if apierrs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func makeIstioRouteRuleSpec(routes []RevisionRoute) configv1alpha2.RouteRuleSpec {
+	spec := configv1alpha2.RouteRuleSpec{
+		Route: make([]configv1alpha2.DestinationWeight, 0, len(routes)),
+	}
+	for _, rt := range routes {
+		spec.Route = append(spec.Route, configv1alpha2.DestinationWeight{
+			Destination: configv1alpha2.IstioService{Name: rt.Service},
+			Weight:      rt.Weight,
+		})
+	}
+	return spec
+}
+
+func makeIstioRouteRules(es *v1alpha1.ElaService, name string, routes []RevisionRoute) *configv1alpha2.RouteRule {
+	serviceRef := metav1.NewControllerRef(es, v1alpha1.SchemeGroupVersion.WithKind("ElaService"))
+	return &configv1alpha2.RouteRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       es.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*serviceRef},
+		},
+		Spec: makeIstioRouteRuleSpec(routes),
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package traffic
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/google/elafros/pkg/apis/ela/v1alpha1"
+)
+
+// noopRouter does nothing. It backs Kind None, for clusters
+// that don't want Knative managing traffic splitting, and for unit tests
+// that don't want to stand up a service mesh.
+type noopRouter struct{}
+
+// NewNoopRouter returns a TrafficRouter whose Reconcile and Delete are
+// both no-ops.
+func NewNoopRouter() TrafficRouter {
+	return noopRouter{}
+}
+
+func (noopRouter) Reconcile(ctx context.Context, es *v1alpha1.ElaService, routes []RevisionRoute) error {
+	return nil
+}
+
+func (noopRouter) Delete(ctx context.Context, nsName types.NamespacedName) error {
+	return nil
+}
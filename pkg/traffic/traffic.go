@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package traffic isolates the per-revision weighted-routing model from any
+// one service-mesh API, so clusters without Istio can still get weighted
+// revision traffic through a different backend.
+package traffic
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/google/elafros/pkg/apis/ela/v1alpha1"
+	elaclientset "github.com/google/elafros/pkg/client/clientset/versioned"
+)
+
+// RevisionRoute represents a single target to route to: a k8s Service name
+// (potentially namespace-qualified) and how much of the traffic goes to it.
+type RevisionRoute struct {
+	Service string
+	Weight  int
+}
+
+// TrafficRouter reconciles the weighted set of RevisionRoutes for an
+// ElaService onto some service-mesh-specific routing resource (Istio
+// RouteRules, a Gateway API HTTPRoute, etc).
+type TrafficRouter interface {
+	// Reconcile creates or updates the routing resource(s) for es so that
+	// traffic is split across routes as specified.
+	Reconcile(ctx context.Context, es *v1alpha1.ElaService, routes []RevisionRoute) error
+	// Delete removes any routing resource(s) owned by nsName.
+	Delete(ctx context.Context, nsName types.NamespacedName) error
+}
+
+// Kind identifies which TrafficRouter implementation to use. It is passed
+// to elaservice.NewController by its caller; no command-line flag sets it.
+type Kind string
+
+const (
+	// Istio routes traffic using Istio v1alpha2 RouteRules. This is the
+	// long-standing default.
+	Istio Kind = "istio"
+	// GatewayAPI routes traffic using gateway.networking.k8s.io HTTPRoutes.
+	GatewayAPI Kind = "gateway-api"
+	// None is a no-op router, useful for unit tests and for clusters that
+	// don't want Knative to manage traffic splitting at all.
+	None Kind = "none"
+)
+
+// New returns the TrafficRouter implementation named by kind.
+func New(kind Kind, deps Dependencies) (TrafficRouter, error) {
+	switch kind {
+	case Istio, "":
+		return NewIstioRouter(deps.ElaClient), nil
+	case GatewayAPI:
+		if deps.GatewayClient == nil {
+			return nil, fmt.Errorf("traffic router kind %q requires a GatewayClient, but none was provided", kind)
+		}
+		return NewGatewayAPIRouter(deps.GatewayClient), nil
+	case None:
+		return NewNoopRouter(), nil
+	default:
+		return nil, fmt.Errorf("unknown traffic router kind %q", kind)
+	}
+}
+
+// Dependencies bundles the clients the various TrafficRouter
+// implementations might need; only the field(s) relevant to the selected
+// Kind need be populated.
+type Dependencies struct {
+	ElaClient     elaclientset.Interface
+	GatewayClient GatewayAPIClient
+}
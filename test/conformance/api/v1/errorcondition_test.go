@@ -19,14 +19,15 @@ limitations under the License.
 package v1
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"testing"
 
-	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"knative.dev/pkg/apis"
+	"knative.dev/pkg/ptr"
 	pkgTest "knative.dev/pkg/test"
 	"knative.dev/pkg/test/logging"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
@@ -38,7 +39,9 @@ import (
 )
 
 const (
-	containerMissing = "ContainerMissing"
+	containerMissing         = "ContainerMissing"
+	progressDeadlineExceeded = "ProgressDeadlineExceeded"
+	revisionMissing          = "RevisionMissing"
 )
 
 // TestContainerErrorMsg is to validate the error condition defined at
@@ -72,8 +75,6 @@ func TestContainerErrorMsg(legacy *testing.T) {
 	names.Config = serviceresourcenames.Configuration(svc)
 	names.Route = serviceresourcenames.Route(svc)
 
-	manifestUnknown := string(transport.ManifestUnknownErrorCode)
-
 	t.Run("API", func(t *logging.TLogger) {
 		t.V(1).Info("When the imagepath is invalid, the Configuration should have error status.")
 		t.V(8).Info("Wait for ServiceState becomes NotReady. It also waits for the creation of Configuration.")
@@ -88,10 +89,10 @@ func TestContainerErrorMsg(legacy *testing.T) {
 			ValidateCondition(t.WithValues(errCtx...), cond)
 			if cond != nil && !cond.IsUnknown() {
 				if cond.IsFalse() && cond.Reason == containerMissing {
-					// Spec does not have constraints on the Message
-					if !strings.Contains(cond.Message, manifestUnknown) {
+					regErr := registryErrorFromMessage(cond.Message)
+					if regErr == nil || regErr.Code != manifestUnknownErrorCode {
 						e2eErrors = append(e2eErrors, logging.Error("Bad Condition.Message testing 'Container image not present' scenario",
-							"wantMessage", manifestUnknown, errCtx...))
+							errCtx...).WithCause(regErr))
 					}
 					if cond.Message != "" {
 						return true, nil
@@ -115,10 +116,10 @@ func TestContainerErrorMsg(legacy *testing.T) {
 			ValidateCondition(t.WithValues(errCtx...), cond)
 			if cond != nil {
 				if cond.Reason == containerMissing {
-					// Spec does not have constraints on the Message
-					if !strings.Contains(cond.Message, manifestUnknown) {
+					regErr := registryErrorFromMessage(cond.Message)
+					if regErr == nil || regErr.Code != manifestUnknownErrorCode {
 						e2eErrors = append(e2eErrors, logging.Error("Bad Condition.Message testing revision with invalid imagepath",
-							"wantMessage", manifestUnknown, errCtx...))
+							errCtx...).WithCause(regErr))
 					}
 					if cond.Message != "" {
 						return true, nil
@@ -260,6 +261,230 @@ func TestContainerExitingMsg(legacy *testing.T) {
 	}
 }
 
+// TestContainerErrorMsgUnauthorized is to validate the error condition defined at
+// https://github.com/knative/serving/blob/master/docs/spec/errors.md
+// for the case where the image lives behind a private registry and no (or an
+// invalid) imagePullSecrets was supplied. This must not be conflated with the
+// ContainerMissing reason used for a genuinely absent image.
+func TestContainerErrorMsgUnauthorized(legacy *testing.T) {
+	t := logging.NewTLogger(legacy)
+	defer t.CleanUp()
+	t.Parallel()
+	clients := test.Setup(t)
+
+	names := test.ResourceNames{
+		Service: test.ObjectNameForTest(t),
+		Image:   test.PrivateHelloWorld,
+	}
+
+	defer test.TearDown(clients, names)
+	test.CleanupOnInterrupt(func() { test.TearDown(clients, names) })
+
+	const unauthorized = "UNAUTHORIZED"
+
+	t.V(2).Info("Creating a new Service with a private image and no imagePullSecrets", "service", names.Service)
+	svc, err := createService(legacy, clients, names, 2)
+	t.FatalIfErr(err, "Failed to create Service")
+
+	names.Config = serviceresourcenames.Configuration(svc)
+	names.Route = serviceresourcenames.Route(svc)
+
+	t.Run("API", func(t *logging.TLogger) {
+		t.V(8).Info("Wait for ServiceState becomes NotReady. It also waits for the creation of Configuration.")
+		err = v1test.WaitForServiceState(clients.ServingClient, names.Service, v1test.IsServiceNotReady, "ServiceIsNotReady")
+		t.FatalIfErr(err, "The Service was unexpected state", "service", names.Service)
+
+		t.V(8).Info("Checking for an UNAUTHORIZED transport error, not ContainerMissing.")
+		err = v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(r *v1.Configuration) (bool, error) {
+			cond := r.Status.GetCondition(v1.ConfigurationConditionReady)
+			errCtx := [4]interface{}{"configuration", names.Config, "condition", cond}
+			ValidateCondition(t.WithValues(errCtx...), cond)
+			if cond != nil && !cond.IsUnknown() {
+				if cond.IsFalse() && cond.Reason != containerMissing && strings.Contains(cond.Message, unauthorized) {
+					return true, nil
+				}
+				return true, logging.Error("The configuration was not marked with the expected auth error condition",
+					"wantMessage", unauthorized, "wantReasonNot", containerMissing, errCtx...)
+			}
+			return false, nil
+		}, "ContainerImageUnauthorized")
+		t.FatalIfErr(err, "Failed to validate configuration state")
+	})
+}
+
+// TestProgressDeadlineExceeded is to validate the error condition defined at
+// https://github.com/knative/serving/blob/master/docs/spec/errors.md
+// for a container that never becomes ready before progressDeadlineSeconds elapses.
+func TestProgressDeadlineExceeded(legacy *testing.T) {
+	t := logging.NewTLogger(legacy)
+	defer t.CleanUp()
+	t.Parallel()
+	clients := test.Setup(t)
+
+	const progressDeadline = "20s"
+
+	names := test.ResourceNames{
+		Config: test.ObjectNameForTest(t),
+		Image:  test.Failing,
+	}
+
+	defer test.TearDown(clients, names)
+	test.CleanupOnInterrupt(func() { test.TearDown(clients, names) })
+
+	t.V(2).Info("Creating a new Configuration with a probe that never succeeds", "configuration", names.Config)
+	_, err := v1test.CreateConfiguration(t, clients, names,
+		rtesting.WithConfigProgressDeadline(progressDeadline),
+		rtesting.WithConfigReadinessProbe(&corev1.Probe{
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/this-path-never-responds"},
+			},
+		}))
+	t.FatalIfErr(err, "Failed to create Configuration", "configuration", names.Config)
+
+	t.Run("API", func(t *logging.TLogger) {
+		t.V(1).Info("When the container never becomes ready, the Revision should surface ProgressDeadlineExceeded.")
+		revisionName, err := getRevisionFromConfiguration(clients, names.Config)
+		t.FatalIfErr(err, "Failed to get revision from configuration", "configuration", names.Config)
+
+		err = v1test.WaitForRevisionState(clients.ServingClient, revisionName, func(r *v1.Revision) (bool, error) {
+			cond := r.Status.GetCondition(v1.RevisionConditionReady)
+			errCtx := [4]interface{}{"revision", revisionName, "condition", cond}
+			ValidateCondition(t.WithValues(errCtx...), cond)
+			if cond != nil && cond.IsFalse() {
+				if cond.Reason == progressDeadlineExceeded {
+					return true, nil
+				}
+				return true, logging.Error("The revision was not marked with the expected error condition",
+					"wantReason", progressDeadlineExceeded, errCtx...)
+			}
+			return false, nil
+		}, "ProgressDeadlineExceeded")
+		t.FatalIfErr(err, "Failed to validate revision state")
+	})
+}
+
+// TestRevisionMissing is to validate the error condition defined at
+// https://github.com/knative/serving/blob/master/docs/spec/errors.md
+// for a Route that targets a Revision which has been deleted out from
+// under it.
+//
+// This deliberately creates a standalone Configuration (not a Service): a
+// Service's reconciler owns its Configuration and would just recreate a new
+// Revision the moment the old one disappeared, so the Route would never
+// observe a missing target. Pointing the Route's traffic directly at the
+// Revision by name, with nothing that owns and restores it, is what
+// actually orphans it.
+func TestRevisionMissing(legacy *testing.T) {
+	t := logging.NewTLogger(legacy)
+	defer t.CleanUp()
+	t.Parallel()
+	clients := test.Setup(t)
+
+	names := test.ResourceNames{
+		Config: test.ObjectNameForTest(t),
+		Route:  test.ObjectNameForTest(t),
+		Image:  test.PizzaPlanet1,
+	}
+
+	defer test.TearDown(clients, names)
+	test.CleanupOnInterrupt(func() { test.TearDown(clients, names) })
+
+	t.V(2).Info("Creating a new Configuration", "configuration", names.Config)
+	_, err := v1test.CreateConfiguration(t, clients, names)
+	t.FatalIfErr(err, "Failed to create Configuration", "configuration", names.Config)
+
+	err = v1test.WaitForConfigurationState(clients.ServingClient, names.Config, v1test.IsConfigurationReady, "ConfigurationIsReady")
+	t.FatalIfErr(err, "Configuration did not become ready", "configuration", names.Config)
+
+	revisionName, err := getRevisionFromConfiguration(clients, names.Config)
+	t.FatalIfErr(err, "Failed to get revision from configuration", "configuration", names.Config)
+
+	t.V(2).Info("Creating a Route that pins its traffic directly to the Revision", "route", names.Route, "revision", revisionName)
+	route := &v1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: names.Route, Namespace: test.ServingFlags.Namespace},
+		Spec: v1.RouteSpec{
+			Traffic: []v1.TrafficTarget{{
+				RevisionName: revisionName,
+				Percent:      ptr.Int64(100),
+			}},
+		},
+	}
+	_, err = clients.ServingClient.Routes.Create(route)
+	t.FatalIfErr(err, "Failed to create Route", "route", names.Route)
+
+	err = v1test.WaitForRouteState(clients.ServingClient, names.Route, v1test.IsRouteReady, "RouteIsReady")
+	t.FatalIfErr(err, "Route did not become ready", "route", names.Route)
+
+	t.V(2).Info("Deleting the Revision the Route targets out-of-band", "revision", revisionName)
+	err = clients.ServingClient.Revisions.Delete(revisionName, &metav1.DeleteOptions{})
+	t.FatalIfErr(err, "Failed to delete Revision", "revision", revisionName)
+
+	t.Run("API", func(t *logging.TLogger) {
+		t.V(1).Info("The Route should surface RevisionMissing once its target Revision is orphaned.")
+		err = v1test.WaitForRouteState(clients.ServingClient, names.Route, func(r *v1.Route) (bool, error) {
+			cond := r.Status.GetCondition(v1.RouteConditionReady)
+			errCtx := [4]interface{}{"route", names.Route, "condition", cond}
+			ValidateCondition(t.WithValues(errCtx...), cond)
+			if cond != nil && cond.IsFalse() {
+				if cond.Reason == revisionMissing {
+					return true, nil
+				}
+				return true, logging.Error("The route was not marked with the expected error condition",
+					"wantReason", revisionMissing, "revision", revisionName, errCtx...)
+			}
+			return false, nil
+		}, "RouteRevisionMissing")
+		t.FatalIfErr(err, "Failed to validate route state")
+	})
+}
+
+// registryErrorCode is one of the machine-checkable error codes a
+// container registry's v2 API returns, as embedded verbatim in the
+// Ready condition's Message by the reconciler. There's no typed error
+// available at this layer to recover via errors.As -- Message is a plain
+// string copied out of the registry's HTTP response -- so the best this
+// test can do is check for the specific code it expects rather than
+// string-matching the whole message.
+type registryErrorCode string
+
+const manifestUnknownErrorCode registryErrorCode = "MANIFEST_UNKNOWN"
+
+// knownRegistryErrorCodes are checked in priority order: a message can
+// legitimately contain more than one all-caps token (timestamps, host
+// names), so this only ever matches codes this test actually cares about,
+// rather than the first all-caps run in the string.
+var knownRegistryErrorCodes = []registryErrorCode{
+	manifestUnknownErrorCode,
+	"UNAUTHORIZED",
+	"NAME_UNKNOWN",
+	"NAME_INVALID",
+}
+
+// registryError wraps the registry error code (if any) found in a
+// condition Message, so callers can assert on err.Code with a typed
+// comparison and recover it via errors.As through logging.Error(...)
+// .WithCause(...), instead of substring-matching the message text
+// directly at the call site.
+type registryError struct {
+	Code    registryErrorCode
+	Message string
+}
+
+func (e *registryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// registryErrorFromMessage recovers a *registryError from a condition
+// Message if (and only if) it contains one of knownRegistryErrorCodes.
+func registryErrorFromMessage(msg string) *registryError {
+	for _, code := range knownRegistryErrorCodes {
+		if strings.Contains(msg, string(code)) {
+			return &registryError{Code: code, Message: msg}
+		}
+	}
+	return nil
+}
+
 // Get revision name from configuration.
 func getRevisionFromConfiguration(clients *test.Clients, configName string) (string, error) {
 	config, err := clients.ServingClient.Configs.Get(configName, metav1.GetOptions{})
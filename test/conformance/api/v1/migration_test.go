@@ -20,35 +20,53 @@ package v1
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
-	// adding testify: https://github.com/stretchr/testify
-	//"github.com/stretchr/testify/assert"
+
 	"github.com/stretchr/testify/require"
-	//"github.com/stretchr/testify/mock"
-	//"github.com/stretchr/testify/suite"
-	// --
+	"github.com/stretchr/testify/suite"
+
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"knative.dev/pkg/test/logstream"
-	v1a1test "knative.dev/serving/test/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
 
+	"knative.dev/pkg/test/logstream"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/apis/serving/v1alpha1"
 	"knative.dev/serving/test"
+	v1a1test "knative.dev/serving/test/v1alpha1"
 )
 
+// legacyShape names one of the rollout shapes a v1alpha1 Service could take
+// before v1, and knows how to build and create it. Each shape gets its own
+// subtest so a broken conversion direction shows up by name, not just as a
+// failure of TestTranslation as a whole.
+type legacyShape struct {
+	Name   string
+	Build  func(names test.ResourceNames) *v1alpha1.Service
+	Create func(t *testing.T, clients *test.Clients, names test.ResourceNames) (*v1alpha1.Service, error)
+}
+
+var legacyShapes = []legacyShape{
+	{Name: "RunLatest", Build: v1a1test.LatestServiceLegacy, Create: v1a1test.CreateLatestServiceLegacy},
+	{Name: "Pinned", Build: v1a1test.PinnedServiceLegacy, Create: v1a1test.CreatePinnedServiceLegacy},
+	{Name: "Release", Build: v1a1test.ReleaseServiceLegacy, Create: v1a1test.CreateReleaseServiceLegacy},
+	{Name: "Manual", Build: v1a1test.ManualServiceLegacy, Create: v1a1test.CreateManualServiceLegacy},
+}
 
+// MigrationTestSuite exercises the v1alpha1 -> v1beta1/v1 -> v1alpha1
+// conversion webhook across every legacy rollout shape.
 type MigrationTestSuite struct {
 	suite.Suite
-	names test.ResourceNames
-	cancel logstream.Canceler
+	names   test.ResourceNames
+	cancel  logstream.Canceler
 	clients *test.Clients
 }
 
 func (s *MigrationTestSuite) SetupSuite() {
-	s.names = test.ResourceNames {
-		Service: test.ObjectNameForTest(t),
-		Image:   "helloworld",
+	s.names = test.ResourceNames{
+		Image: "helloworld",
 	}
 	s.clients = test.Setup(s.T())
 	test.CleanupOnInterrupt(func() { test.TearDown(s.clients, s.names) })
@@ -59,52 +77,80 @@ func (s *MigrationTestSuite) TearDownSuite() {
 }
 
 func (s *MigrationTestSuite) SetupTest() {
-	s.T().Parallel()
 	s.cancel = logstream.Start(s.T())
 }
 
 func (s *MigrationTestSuite) TearDownTest() {
-	cancel := s.cancel
-	cancel()
-}
-/*
-func (s *MigrationTestSuite) BeforeTest(_, _ string) {
-	
+	s.cancel()
 }
 
-func (s *MigrationTestSuite) AfterTest(_, _ string) {
-	
+// TestTranslation creates each legacy shape as v1alpha1, re-fetches it
+// through the v1beta1 and v1 typed clients and the dynamic client, and
+// asserts that PodSpec, TrafficTargets, and the Revision/Configuration
+// templates all round-trip losslessly back down to v1alpha1.
+func (s *MigrationTestSuite) TestTranslation() {
+	for _, shape := range legacyShapes {
+		shape := shape
+		s.Run(shape.Name, func() {
+			require := require.New(s.T())
+			names := s.names
+			names.Service = test.ObjectNameForTest(s.T())
+
+			s.T().Logf("Creating a legacy %s Service", shape.Name)
+			service, err := shape.Create(s.T(), s.clients, names)
+			require.NoError(err, "Failed to create initial Service %q: %v", names.Service, err)
+
+			v1b1, err := s.clients.ServingBetaClient.Services.Get(names.Service, metav1.GetOptions{})
+			require.NoError(err, "Failed to get v1beta1.Service %q: %v", names.Service, err)
+
+			v1Svc, err := s.clients.ServingClient.Services.Get(names.Service, metav1.GetOptions{})
+			require.NoError(err, "Failed to get v1.Service %q: %v", names.Service, err)
+
+			gvr := v1alpha1.SchemeGroupVersion.WithResource("services")
+			u, err := s.clients.Dynamic.Resource(gvr).Namespace(names.Namespace).
+				Get(names.Service, metav1.GetOptions{})
+			require.NoError(err, "Failed to get v1alpha1.Service %q via dynamic client: %v", names.Service, err)
+			roundTripped := &v1alpha1.Service{}
+			require.NoError(runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, roundTripped),
+				"Failed to parse unstructured as v1alpha1.Service %q", names.Service)
+
+			require.True(equality.Semantic.DeepEqual(v1b1.Spec.Template.Spec.PodSpec, service.Spec.Template.Spec.PodSpec),
+				"v1beta1 PodSpec diverged from the original for %s %q", shape.Name, names.Service)
+			require.True(equality.Semantic.DeepEqual(v1Svc.Spec.Template.Spec.PodSpec, service.Spec.Template.Spec.PodSpec),
+				"v1 PodSpec diverged from the original for %s %q", shape.Name, names.Service)
+			require.True(equality.Semantic.DeepEqual(roundTripped.Spec.Template, service.Spec.Template),
+				"round-tripped v1alpha1 Template diverged from the original for %s %q", shape.Name, names.Service)
+			require.True(equality.Semantic.DeepEqual(roundTripped.Spec.Traffic, service.Spec.Traffic),
+				"round-tripped v1alpha1 TrafficTargets diverged from the original for %s %q", shape.Name, names.Service)
+		})
+	}
 }
-*/
 
-func (suite *MigrationTestSuite)TestTranslation() {
-	require := require.New(suite.T())
+// TestMutuallyExclusiveRolloutRejection asserts that the webhook rejects a
+// Service whose Spec sets more than one of the mutually exclusive legacy
+// rollout fields, and that the error text names the offending fields so a
+// caller can tell what's wrong.
+func (s *MigrationTestSuite) TestMutuallyExclusiveRolloutRejection() {
+	require := require.New(s.T())
+	names := s.names
+	names.Service = test.ObjectNameForTest(s.T())
 
-	suite.T().Log("Creating a new Service")
-	// Create a legacy RunLatest service.  This should perform conversion during the webhook
-	// and return back a converted service resource.
-	service, err := v1a1test.CreateLatestServiceLegacy(suite.T(), clients, names)
-	require.NotNil(err, "Failed to create initial Service: %v: %v", names.Service, err)
-
-	// Access the service over the v1 endpoint.
-	v1b1, err := clients.ServingClient.Services.Get(service.Name, metav1.GetOptions{})
-	require.NotNil(err, "Failed to get v1.Service: %v: %v", names.Service, err)
-
-	// Access the service over the v1 endpoint.
-	v1, err := clients.ServingClient.Services.Get(service.Name, metav1.GetOptions{})
-	require.NotNil(err, "Failed to get v1.Service: %v: %v", names.Service, err)
+	service := v1a1test.LatestServiceLegacy(names)
+	service.Spec.Pinned = v1a1test.PinnedServiceLegacy(names).Spec.Pinned
 
-	// Check that all PodSpecs match
-	require.True(equality.Semantic.DeepEqual(v1b1.Spec.Template.Spec.PodSpec, service.Spec.Template.Spec.PodSpec),
-		"Failed to parse unstructured as v1.Service: %v: %v", names.Service, err)
-	require.True(equality.Semantic.DeepEqual(v1.Spec.Template.Spec.PodSpec, service.Spec.Template.Spec.PodSpec),
-		"Failed to parse unstructured as v1.Service: %v: %v", names.Service, err)
+	_, err := s.clients.ServingAlphaClient.Services.Create(service)
+	require.Error(err, "Unexpectedly created a Service with both runLatest and pinned set: %q", names.Service)
+	require.True(strings.Contains(err.Error(), "runLatest") && strings.Contains(err.Error(), "pinned"),
+		"Webhook error %q did not name both conflicting fields", err)
 }
 
-func (suite *MigrationTestSuite)TestV1beta1Rejection() {
-	require := require.New(suite.T())
+// TestV1Rejection asserts that a legacy v1alpha1-shaped payload sent
+// directly to the v1 resource is rejected rather than silently accepted.
+func (s *MigrationTestSuite) TestV1Rejection() {
+	require := require.New(s.T())
+	names := s.names
+	names.Service = test.ObjectNameForTest(s.T())
 
-	suite.T().Log("Creating a new Service")
 	// Create a legacy RunLatest service, but give it the TypeMeta of v1.
 	service := v1a1test.LatestServiceLegacy(names)
 	service.APIVersion = v1.SchemeGroupVersion.String()
@@ -112,18 +158,17 @@ func (suite *MigrationTestSuite)TestV1beta1Rejection() {
 
 	// Turn it into an unstructured resource for sending through the dynamic client.
 	b, err := json.Marshal(service)
-	require.Nil(err, "Failed to marshal v1alpha1.Service: %v: %v", names.Service, err)
+	require.NoError(err, "Failed to marshal v1alpha1.Service %q: %v", names.Service, err)
 	u := &unstructured.Unstructured{}
-	err1 := json.Unmarshal(b, u)
-	require.NotNil(err1, "Failed to unmarshal as unstructured: %v: %v", names.Service, err1)
+	require.NoError(json.Unmarshal(b, u), "Failed to unmarshal v1alpha1.Service %q as unstructured", names.Service)
 
 	// Try to create the "run latest" service through v1.
 	gvr := v1.SchemeGroupVersion.WithResource("services")
-	svc, err2 := clients.Dynamic.Resource(gvr).Namespace(service.Namespace).
+	svc, err := s.clients.Dynamic.Resource(gvr).Namespace(names.Namespace).
 		Create(u, metav1.CreateOptions{})
-	require.NotNil(err2, "Unexpected success creating %#v", svc)
+	require.Error(err, "Unexpectedly created a legacy-shaped Service through v1: %#v", svc)
 }
 
 func TestMigrationTestSuite(t *testing.T) {
 	suite.Run(t, new(MigrationTestSuite))
-}
\ No newline at end of file
+}
@@ -0,0 +1,205 @@
+// +build e2e
+
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgTest "knative.dev/pkg/test"
+	"knative.dev/pkg/test/logstream"
+	"knative.dev/pkg/test/spoof"
+
+	"knative.dev/serving/test"
+	v1a1test "knative.dev/serving/test/v1alpha1"
+)
+
+var (
+	// soakDuration is how long MigrationSoakSuite keeps flipping the
+	// Service between API versions while load is in flight.
+	soakDuration = flag.Duration("migrationsoak.duration", 2*time.Minute, "How long to soak-test CRD version transitions under load.")
+	// soakFailureThreshold is the fraction of probe requests allowed to
+	// fail (5xx response or transport error) before the soak is considered
+	// failed. It defaults to zero, so by default any failed request fails
+	// the soak.
+	soakFailureThreshold = flag.Float64("migrationsoak.failure-threshold", 0.0, "Fraction of probe requests allowed to fail during the soak.")
+)
+
+// MigrationSoakSuite builds on MigrationTestSuite's TestTranslation: it
+// creates a single v1alpha1 Service, then keeps traffic flowing to it via
+// a background prober goroutine while repeatedly flipping the Service
+// between its v1alpha1, v1beta1, and v1 views over soakDuration. Unlike a
+// single require.True(DeepEqual(...)) check, this catches webhook
+// conversion races and rollout hiccups that only show up under
+// concurrent traffic.
+type MigrationSoakSuite struct {
+	suite.Suite
+	names   test.ResourceNames
+	cancel  logstream.Canceler
+	clients *test.Clients
+}
+
+func (s *MigrationSoakSuite) SetupSuite() {
+	s.names = test.ResourceNames{
+		Service: test.ObjectNameForTest(s.T()),
+		Image:   "helloworld",
+	}
+	s.clients = test.Setup(s.T())
+	test.CleanupOnInterrupt(func() { test.TearDown(s.clients, s.names) })
+}
+
+func (s *MigrationSoakSuite) TearDownSuite() {
+	test.TearDown(s.clients, s.names)
+}
+
+func (s *MigrationSoakSuite) SetupTest() {
+	s.cancel = logstream.Start(s.T())
+}
+
+func (s *MigrationSoakSuite) TearDownTest() {
+	s.cancel()
+}
+
+// soakProbeResult tallies requests and failures seen by the background
+// load generator over the life of the soak.
+type soakProbeResult struct {
+	requests int64
+	failures int64
+}
+
+func (r *soakProbeResult) failureRate() float64 {
+	reqs := atomic.LoadInt64(&r.requests)
+	if reqs == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&r.failures)) / float64(reqs)
+}
+
+// probeRoute hits url every 200ms until stopCh closes, tallying the
+// result into result.
+func probeRoute(t *testing.T, client *spoof.SpoofingClient, url string, result *soakProbeResult, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			atomic.AddInt64(&result.requests, 1)
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				atomic.AddInt64(&result.failures, 1)
+				continue
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				atomic.AddInt64(&result.failures, 1)
+				continue
+			}
+			// Drain and close the body so a prober hitting every 200ms for
+			// the life of the soak doesn't leak a connection per request.
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= http.StatusInternalServerError {
+				atomic.AddInt64(&result.failures, 1)
+			}
+		}
+	}
+}
+
+// TestTrafficSurvivesVersionFlips creates a RunLatest Service, keeps
+// traffic flowing to its route, and repeatedly updates the Service
+// through the v1alpha1, v1beta1, and v1 typed clients in turn for
+// soakDuration. It asserts the observed failure rate does not exceed
+// soakFailureThreshold and that no extra Revisions were created along the
+// way (flipping API versions must not itself trigger a rollout).
+func (s *MigrationSoakSuite) TestTrafficSurvivesVersionFlips() {
+	require := require.New(s.T())
+	names := s.names
+
+	s.T().Log("Creating a RunLatest Service to soak")
+	service, err := v1a1test.CreateLatestServiceLegacy(s.T(), s.clients, names)
+	require.NoError(err, "Failed to create initial Service %q: %v", names.Service, err)
+
+	names.Route = service.Status.RouteStatusFields.URL.Host
+	wantRevision := service.Status.LatestReadyRevisionName
+
+	client, err := pkgTest.NewSpoofingClient(s.clients.KubeClient, s.T().Logf, names.Route, test.ServingFlags.ResolvableDomain, test.AddRootCAtoTransport(s.T().Logf, s.clients, test.ServingFlags.HTTPS))
+	require.NoError(err, "Failed to create spoofing client for %q: %v", names.Route, err)
+
+	result := &soakProbeResult{}
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		probeRoute(s.T(), client, "http://"+names.Route, result, stopCh)
+	}()
+
+	deadline := time.Now().Add(*soakDuration)
+	flip := 0
+	for time.Now().Before(deadline) {
+		switch flip % 3 {
+		case 0:
+			svc, err := s.clients.ServingAlphaClient.Services.Get(names.Service, metav1.GetOptions{})
+			require.NoError(err, "Failed to get v1alpha1.Service %q: %v", names.Service, err)
+			_, err = s.clients.ServingAlphaClient.Services.Update(svc)
+			require.NoError(err, "Failed to update v1alpha1.Service %q: %v", names.Service, err)
+		case 1:
+			svc, err := s.clients.ServingBetaClient.Services.Get(names.Service, metav1.GetOptions{})
+			require.NoError(err, "Failed to get v1beta1.Service %q: %v", names.Service, err)
+			_, err = s.clients.ServingBetaClient.Services.Update(svc)
+			require.NoError(err, "Failed to update v1beta1.Service %q: %v", names.Service, err)
+		case 2:
+			svc, err := s.clients.ServingClient.Services.Get(names.Service, metav1.GetOptions{})
+			require.NoError(err, "Failed to get v1.Service %q: %v", names.Service, err)
+			_, err = s.clients.ServingClient.Services.Update(svc)
+			require.NoError(err, "Failed to update v1.Service %q: %v", names.Service, err)
+		}
+		flip++
+		time.Sleep(time.Second)
+	}
+
+	close(stopCh)
+	wg.Wait()
+
+	s.T().Logf("Soak complete: %d requests, %d failures (%.2f%% failure rate)",
+		result.requests, result.failures, result.failureRate()*100)
+	require.LessOrEqual(result.failureRate(), *soakFailureThreshold,
+		"Observed failure rate %.4f exceeded threshold %.4f during version-flip soak", result.failureRate(), *soakFailureThreshold)
+
+	gotRevision, err := s.clients.ServingClient.Services.Get(names.Service, metav1.GetOptions{})
+	require.NoError(err, "Failed to get final v1.Service %q: %v", names.Service, err)
+	require.Equal(wantRevision, gotRevision.Status.LatestReadyRevisionName,
+		"Flipping API versions unexpectedly rolled out a new Revision for %q", names.Service)
+}
+
+func TestMigrationSoakSuite(t *testing.T) {
+	suite.Run(t, new(MigrationSoakSuite))
+}
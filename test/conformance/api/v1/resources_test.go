@@ -19,18 +19,14 @@ limitations under the License.
 package v1
 
 import (
-	"fmt"
-	"net/http"
-	"net/url"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog"
 	pkgTest "knative.dev/pkg/test"
 	"knative.dev/pkg/test/logging"
-	"knative.dev/pkg/test/spoof"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/test"
 	v1test "knative.dev/serving/test/v1"
 
@@ -43,109 +39,196 @@ func init() {
 	resourceLimit = resource.MustParse("350Mi")
 }
 
+// resourceEnforcementCase describes a single resource limit/request to apply to
+// the Service under test, and what is expected to happen when the test image is
+// asked to consume progressively more of that resource.
+type resourceEnforcementCase struct {
+	Name      string
+	Image     string
+	Resources corev1.ResourceRequirements
+	// WantReady is false for cases that are expected to never become Ready
+	// (e.g. a resource request the cluster can't schedule).
+	WantReady bool
+	// Stress, when non-empty, is run against the live Service's endpoint once
+	// Ready: a sequence of (kind, magnitude, wantSuccess) probes.
+	Stress []stressStep
+	// WantStressUnready, if true, asserts the Revision goes Ready=False once
+	// the Stress sequence has pushed usage past its limit. We don't assert a
+	// specific Reason: Knative doesn't guarantee a stable literal string for
+	// an evicted/OOMKilled pod, only that Ready flips to false.
+	WantStressUnready bool
+}
+
+type stressStep struct {
+	Kind        v1test.StressKind
+	Magnitude   int
+	WantSuccess bool
+}
+
 func TestCustomResourcesLimits(legacy *testing.T) {
 	t := logging.NewTLogger(legacy)
 	defer t.CleanUp()
 	t.Parallel()
-	clients := test.Setup(t)
 
-	withResources := rtesting.WithResourceRequirements(corev1.ResourceRequirements{
-		Limits: corev1.ResourceList{
-			corev1.ResourceMemory: resourceLimit,
+	tests := []resourceEnforcementCase{{
+		Name:  "memory",
+		Image: test.Autoscale,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resourceLimit,
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceMemory: resourceLimit,
+			},
 		},
-		Requests: corev1.ResourceList{
-			corev1.ResourceMemory: resourceLimit,
+		WantReady: true,
+		Stress: []stressStep{
+			{Kind: v1test.StressMemory, Magnitude: 100, WantSuccess: true},
+			{Kind: v1test.StressMemory, Magnitude: 200, WantSuccess: true},
+			{Kind: v1test.StressMemory, Magnitude: 500, WantSuccess: false},
 		},
-	})
-
-	names := test.ResourceNames{
-		Service: test.ObjectNameForTest(t),
-		Image:   test.Autoscale,
-	}
-
-	test.CleanupOnInterrupt(func() { test.TearDown(clients, names) })
-	defer test.TearDown(clients, names)
-
-	objects, err := v1test.CreateServiceReady(t, clients, &names, withResources)
-	t.FatalIfErr(err, "Failed to create initial Service", "name", names.Service)
-
-	t.Run("API", func(t *logging.TLogger) {
-		svc, err := clients.ServingClient.Revisions.Get(objects.Revision.Status.ServiceName, metav1.GetOptions{})
-		t.FatalIfErr(err, "Failed requesting information about Revision")
-
-		// TODO: need to not panic if any nil pointers/missing keys
-		resources := svc.Spec.Containers[0].Resources
-		limit := resources.Limits["memory"]
-		request := resources.Requests["memory"]
-
-		if limit.Cmp(resourceLimit) != 0 {
-			t.Error("Memory limit did not match", "want", resourceLimit, "got", limit)
-		}
-		if request.Cmp(resourceLimit) != 0 {
-			t.Error("Memory request did not match", "want", resourceLimit, "got", request)
-		}
-	})
-
-	// This is e2e, not Runtime, because k8s does not require implementations to terminate
-	// See https://github.com/knative/serving/pull/6014#issuecomment-553714724
-	t.Run("e2e", func(t *logging.TLogger) {
-		endpoint := objects.Route.Status.URL.URL()
-		_, err = pkgTest.WaitForEndpointState(
-			clients.KubeClient,
-			t.Logf,
-			endpoint,
-			v1test.RetryingRouteInconsistency(pkgTest.MatchesAllOf(pkgTest.IsStatusOK)),
-			"ResourceTestServesText",
-			test.ServingFlags.ResolvableDomain)
-		t.FatalIfErr(err, "Error probing", "URL", endpoint)
-
-		sendPostRequest := func(resolvableDomain bool, url *url.URL) (*spoof.Response, error) {
-			client, err := pkgTest.NewSpoofingClient(clients.KubeClient, klog.V(4).Infof, url.Hostname(), resolvableDomain)
-			if err != nil {
-				return nil, err
+	}, {
+		Name:  "cpu",
+		Image: test.Autoscale,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("100m"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("100m"),
+			},
+		},
+		WantReady: true,
+		Stress: []stressStep{
+			// A 500ms burn under a 100m CPU limit should be visibly throttled:
+			// we don't assert a strict p99 bound here (that's environment
+			// dependent), only that the request still completes rather than
+			// being rejected outright.
+			{Kind: v1test.StressCPU, Magnitude: 500, WantSuccess: true},
+		},
+	}, {
+		Name:  "ephemeral-storage",
+		Image: test.Autoscale,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceEphemeralStorage: resource.MustParse("200Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceEphemeralStorage: resource.MustParse("200Mi"),
+			},
+		},
+		WantReady: true,
+		Stress: []stressStep{
+			{Kind: v1test.StressDisk, Magnitude: 50, WantSuccess: true},
+			// Writing well past the limit should get the pod Evicted, which
+			// Knative should surface as a Ready=False condition rather than a
+			// successful response.
+			{Kind: v1test.StressDisk, Magnitude: 400, WantSuccess: false},
+		},
+		WantStressUnready: true,
+	}, {
+		Name:  "gpu-unschedulable",
+		Image: test.Autoscale,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				"nvidia.com/gpu": resource.MustParse("1"),
+			},
+			Requests: corev1.ResourceList{
+				"nvidia.com/gpu": resource.MustParse("1"),
+			},
+		},
+		// The cluster doesn't advertise this resource, so the Configuration
+		// should end up NotReady rather than hanging forever.
+		WantReady: false,
+	}}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, func(t *logging.TLogger) {
+			t.Parallel()
+			clients := test.Setup(t)
+
+			names := test.ResourceNames{
+				Service: test.ObjectNameForTest(t),
+				Image:   tt.Image,
 			}
-
-			req, err := http.NewRequest(http.MethodPost, url.String(), nil)
-			if err != nil {
-				return nil, err
+			if !tt.WantReady {
+				// This case creates a bare Configuration, which needs a name.
+				names.Config = names.Service
 			}
-			return client.Do(req)
-		}
 
-		bloatAndCheck := func(mb int, wantSuccess bool) {
-			expect := "failure"
-			if wantSuccess {
-				expect = "success"
+			test.CleanupOnInterrupt(func() { test.TearDown(clients, names) })
+			defer test.TearDown(clients, names)
+
+			withResources := rtesting.WithResourceRequirements(tt.Resources)
+
+			if !tt.WantReady {
+				t.Run("API", func(t *logging.TLogger) {
+					_, err := v1test.CreateConfiguration(t, clients, names, withResources)
+					t.FatalIfErr(err, "Failed to create Configuration", "name", names.Config)
+
+					err = v1test.WaitForConfigurationState(clients.ServingClient, names.Config, func(r *v1.Configuration) (bool, error) {
+						cond := r.Status.GetCondition(v1.ConfigurationConditionReady)
+						if cond != nil && cond.IsFalse() {
+							t.V(2).Info("Configuration went NotReady", "reason", cond.Reason)
+							return true, nil
+						}
+						return false, nil
+					}, "ConfigurationUnschedulable")
+					t.FatalIfErr(err, "Configuration requesting an unavailable resource did not go NotReady", "name", names.Config)
+				})
+				return
 			}
-			t.V(2).Info("Bloating", "MB increase", mb, "want", expect)
-			u, _ := url.Parse(endpoint.String())
-			q := u.Query()
-			q.Set("bloat", fmt.Sprintf("%d", mb))
-			u.RawQuery = q.Encode()
-			response, err := sendPostRequest(test.ServingFlags.ResolvableDomain, u)
-			if err != nil {
-				t.V(5).Info("Received error from sendPostRequest (may be expected)", "error", err)
-				if wantSuccess {
-					t.Error("Didn't get a response from bloating RAM", "MB", mb)
+
+			objects, err := v1test.CreateServiceReady(t, clients, &names, withResources)
+			t.FatalIfErr(err, "Failed to create initial Service", "name", names.Service)
+
+			t.Run("API", func(t *logging.TLogger) {
+				svc, err := clients.ServingClient.Revisions.Get(objects.Revision.Status.ServiceName, metav1.GetOptions{})
+				t.FatalIfErr(err, "Failed requesting information about Revision")
+
+				got := svc.Spec.Containers[0].Resources
+				for name, want := range tt.Resources.Limits {
+					if have := got.Limits[name]; have.Cmp(want) != 0 {
+						t.Error("Resource limit did not match", "resource", name, "want", want, "got", have)
+					}
 				}
-			} else if response.StatusCode == http.StatusOK {
-				if !wantSuccess {
-					t.Error("We shouldn't have got a response from bloating RAM", "MB", mb)
+				for name, want := range tt.Resources.Requests {
+					if have := got.Requests[name]; have.Cmp(want) != 0 {
+						t.Error("Resource request did not match", "resource", name, "want", want, "got", have)
+					}
 				}
-			} else if response.StatusCode == http.StatusBadRequest {
-				t.Error("Test Issue: Received BadRequest from test app, which probably means the test & test image are not cooperating with each other.")
-			} else {
-				// Accept all other StatusCode as failure; different systems could return 404, 502, etc on failure
-				t.V(5).Info("Received non-OK http code from sendPostRequest; interpreting as failure of bloat", "StatusCode", response.StatusCode)
-				if wantSuccess {
-					t.Error("Didn't get a good response from bloating RAM", "MB", mb)
+			})
+
+			// This is e2e, not Runtime, because k8s does not require implementations to terminate
+			// See https://github.com/knative/serving/pull/6014#issuecomment-553714724
+			t.Run("e2e", func(t *logging.TLogger) {
+				endpoint := objects.Route.Status.URL.URL()
+				_, err = pkgTest.WaitForEndpointState(
+					clients.KubeClient,
+					t.Logf,
+					endpoint,
+					v1test.RetryingRouteInconsistency(pkgTest.MatchesAllOf(pkgTest.IsStatusOK)),
+					"ResourceTestServesText",
+					test.ServingFlags.ResolvableDomain)
+				t.FatalIfErr(err, "Error probing", "URL", endpoint)
+
+				for _, s := range tt.Stress {
+					v1test.StressAndCheck(t, clients.KubeClient, test.ServingFlags.ResolvableDomain, endpoint, s.Kind, s.Magnitude, s.WantSuccess)
 				}
-			}
-		}
 
-		t.V(1).Info("Querying the application to see if the memory limits are enforced.")
-		bloatAndCheck(100, true)
-		bloatAndCheck(200, true)
-		bloatAndCheck(500, false)
-	})
+				if tt.WantStressUnready {
+					err = v1test.WaitForRevisionState(clients.ServingClient, objects.Revision.Name, func(r *v1.Revision) (bool, error) {
+						cond := r.Status.GetCondition(v1.RevisionConditionReady)
+						if cond != nil && cond.IsFalse() {
+							t.V(2).Info("Revision went NotReady", "reason", cond.Reason)
+							return true, nil
+						}
+						return false, nil
+					}, "RevisionResourceExceeded")
+					t.FatalIfErr(err, "Revision did not go NotReady after exceeding its resource limit", "name", objects.Revision.Name)
+				}
+			})
+		})
+	}
 }
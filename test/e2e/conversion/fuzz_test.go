@@ -0,0 +1,166 @@
+// +build e2e
+
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package conversion fuzzes v1alpha1 Service/Route/Configuration/Revision
+// objects, creates them, reads them back as their v1 (hub) representation,
+// converts that result back to v1alpha1 client-side using the registered
+// conversion functions, and asserts the result is semantically unchanged.
+// Table-driven conformance tests cover the shapes we know about; this
+// package exists to catch the ones we don't.
+package conversion
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+
+	"knative.dev/pkg/apis"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/apis/serving/v1alpha1"
+	"knative.dev/serving/test"
+)
+
+var (
+	// iterations is how many fuzzed objects to round-trip per resource
+	// kind. CI runs a fast pass; nightly runs pass a much larger value via
+	// -conversion.iterations.
+	iterations = flag.Int("conversion.iterations", 25, "Number of fuzzed objects to round-trip per resource kind.")
+	// seed seeds the fuzzer's RNG. CI pins this for reproducibility;
+	// nightly runs pass -conversion.seed=0 to get a fresh seed every run.
+	seed = flag.Int64("conversion.seed", 1, "Seed for the conversion fuzzer's RNG. 0 picks a time-based seed.")
+)
+
+// fuzzedKind describes one resource kind to fuzz: how to build an empty
+// v1alpha1 instance for the fuzzer to fill in, the GroupVersionResource to
+// POST it to, the GroupVersionResource to GET its hub (v1) representation
+// back from, and how to build an empty hub instance to decode that into.
+type fuzzedKind struct {
+	Name   string
+	New    func() apis.Convertible
+	NewHub func() apis.Convertible
+	GVR    schema.GroupVersionResource
+	HubGVR schema.GroupVersionResource
+}
+
+var fuzzedKinds = []fuzzedKind{
+	{
+		Name:   "Service",
+		New:    func() apis.Convertible { return &v1alpha1.Service{} },
+		NewHub: func() apis.Convertible { return &v1.Service{} },
+		GVR:    v1alpha1.SchemeGroupVersion.WithResource("services"),
+		HubGVR: v1.SchemeGroupVersion.WithResource("services"),
+	}, {
+		Name:   "Route",
+		New:    func() apis.Convertible { return &v1alpha1.Route{} },
+		NewHub: func() apis.Convertible { return &v1.Route{} },
+		GVR:    v1alpha1.SchemeGroupVersion.WithResource("routes"),
+		HubGVR: v1.SchemeGroupVersion.WithResource("routes"),
+	}, {
+		Name:   "Configuration",
+		New:    func() apis.Convertible { return &v1alpha1.Configuration{} },
+		NewHub: func() apis.Convertible { return &v1.Configuration{} },
+		GVR:    v1alpha1.SchemeGroupVersion.WithResource("configurations"),
+		HubGVR: v1.SchemeGroupVersion.WithResource("configurations"),
+	}, {
+		Name:   "Revision",
+		New:    func() apis.Convertible { return &v1alpha1.Revision{} },
+		NewHub: func() apis.Convertible { return &v1.Revision{} },
+		GVR:    v1alpha1.SchemeGroupVersion.WithResource("revisions"),
+		HubGVR: v1.SchemeGroupVersion.WithResource("revisions"),
+	},
+}
+
+// TestConversionRoundTrip fuzzes each resource kind in fuzzedKinds, defaults
+// it the way the webhook would, creates it as v1alpha1, fetches it back
+// through the dynamic client as its v1 hub representation (exercising the
+// conversion webhook), converts that result back to v1alpha1 client-side via
+// ConvertFrom, and asserts the two v1alpha1 objects are semantically equal.
+// ConfigurationSpec.DeprecatedBuild and RevisionSpec.DeprecatedConcurrencyModel
+// are cleared by normalizeForRoundTrip before the comparison, so losses in
+// those two fields are not detected here.
+func TestConversionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	clients := test.Setup(t)
+
+	rngSeed := *seed
+	if rngSeed == 0 {
+		rngSeed = time.Now().UnixNano()
+	}
+	t.Logf("Fuzzing with seed %d, %d iterations per kind", rngSeed, *iterations)
+
+	codecs := serializer.NewCodecFactory(test.Scheme)
+	f := fuzzer.FuzzerFor(fuzzer.MergeFuzzerFuncs(), rand.NewSource(rngSeed), codecs)
+
+	for _, kind := range fuzzedKinds {
+		kind := kind
+		t.Run(kind.Name, func(t *testing.T) {
+			require := require.New(t)
+			for i := 0; i < *iterations; i++ {
+				want := kind.New()
+				f.Fuzz(want)
+				normalizeForRoundTrip(want.(runtime.Object))
+				defaultForRoundTrip(ctx, want.(runtime.Object))
+
+				u, err := toUnstructured(want.(runtime.Object))
+				require.NoError(err, "Failed to convert fuzzed %s to unstructured", kind.Name)
+
+				ns := test.ObjectPrefixForTest(t)
+				u.SetNamespace(ns)
+				u.SetName("")
+				u.SetGenerateName("conversion-fuzz-")
+
+				created, err := clients.Dynamic.Resource(kind.GVR).Namespace(ns).Create(u, metav1.CreateOptions{})
+				require.NoError(err, "Failed to create fuzzed %s (iteration %d)", kind.Name, i)
+
+				hubObj, err := clients.Dynamic.Resource(kind.HubGVR).Namespace(ns).Get(created.GetName(), metav1.GetOptions{})
+				require.NoError(err, "Failed to fetch created %s back as its hub version", kind.Name)
+
+				hub := kind.NewHub()
+				require.NoError(runtime.DefaultUnstructuredConverter.FromUnstructured(hubObj.Object, hub),
+					"Failed to convert hub %s from unstructured", kind.Name)
+
+				got := kind.New()
+				require.NoError(got.ConvertFrom(ctx, hub), "Failed to convert hub %s back to v1alpha1", kind.Name)
+				normalizeForRoundTrip(got.(runtime.Object))
+
+				require.Empty(cmp.Diff(want, got, cmpOptsFor(kind.Name)...),
+					"%s round-trip (iteration %d) changed semantically (-want +got)", kind.Name, i)
+			}
+		})
+	}
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,100 @@
+// +build e2e
+
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conversion
+
+import (
+	"context"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"knative.dev/serving/pkg/apis/serving/v1alpha1"
+)
+
+// normalizeForRoundTrip clears the fields the fuzzer happily fills in but
+// that a real create call would never preserve verbatim: server-assigned
+// metadata, Status (dropped by Create's status subresource, and never
+// populated by a real reconciler in this test), and the deprecated fields
+// that are known to be intentionally dropped on the way through v1 rather
+// than round-tripped.
+func normalizeForRoundTrip(obj runtime.Object) {
+	switch o := obj.(type) {
+	case *v1alpha1.Service:
+		normalizeObjectMeta(&o.ObjectMeta)
+		o.Status = v1alpha1.ServiceStatus{}
+	case *v1alpha1.Route:
+		normalizeObjectMeta(&o.ObjectMeta)
+		o.Status = v1alpha1.RouteStatus{}
+	case *v1alpha1.Configuration:
+		normalizeObjectMeta(&o.ObjectMeta)
+		o.Status = v1alpha1.ConfigurationStatus{}
+		// The v1 Configuration CRD has no Build field; it's intentionally
+		// dropped, not round-tripped.
+		o.Spec.DeprecatedBuild = nil
+	case *v1alpha1.Revision:
+		normalizeObjectMeta(&o.ObjectMeta)
+		o.Status = v1alpha1.RevisionStatus{}
+		// ConcurrencyModel was replaced by ContainerConcurrency; the
+		// conversion webhook only ever writes the latter.
+		o.Spec.DeprecatedConcurrencyModel = ""
+	}
+}
+
+func normalizeObjectMeta(m *metav1.ObjectMeta) {
+	m.Name = ""
+	m.GenerateName = ""
+	m.Namespace = ""
+	m.UID = ""
+	m.ResourceVersion = ""
+	m.Generation = 0
+	m.CreationTimestamp = metav1.Time{}
+	m.SelfLink = ""
+	m.ManagedFields = nil
+}
+
+// defaultForRoundTrip runs obj through the same defaulting webhook the API
+// server applies on create, so a fuzzed field the server is going to
+// overwrite (containerConcurrency, timeoutSeconds, the revision-template
+// name, etc.) doesn't read as a false round-trip failure.
+func defaultForRoundTrip(ctx context.Context, obj runtime.Object) {
+	if d, ok := obj.(apisDefaultable); ok {
+		d.SetDefaults(ctx)
+	}
+}
+
+// apisDefaultable mirrors knative.dev/pkg/apis.Defaultable, which every
+// v1alpha1 serving type implements.
+type apisDefaultable interface {
+	SetDefaults(ctx context.Context)
+}
+
+// cmpOptsFor returns the cmp.Options that should be ignored when diffing a
+// round-tripped object of the given kind: the same server-assigned metadata
+// normalizeForRoundTrip clears, since Create always stamps those regardless
+// of what was fuzzed in.
+func cmpOptsFor(kind string) cmp.Options {
+	return cmp.Options{
+		cmpopts.IgnoreFields(metav1.ObjectMeta{},
+			"Name", "GenerateName", "Namespace", "UID", "ResourceVersion",
+			"Generation", "CreationTimestamp", "SelfLink", "ManagedFields"),
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// autoscale is the test image behind test.Autoscale: a handler that answers
+// each request, optionally after first consuming memory, CPU, or disk, so
+// conformance tests can drive resource enforcement from the outside. Each resource is triggered by its own query parameter so a
+// single image can back every resourceEnforcementCase in resources_test.go.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const diskFillDir = "/tmp/autoscale-disk-fill"
+
+func main() {
+	http.HandleFunc("/", handler)
+	log.Print("Autoscale test app started")
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	if v := r.FormValue("bloat"); v != "" {
+		if err := bloat(v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if v := r.FormValue("burn"); v != "" {
+		if err := burn(v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if v := r.FormValue("disk"); v != "" {
+		if err := fillDisk(v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Fprintln(w, "Autoscale")
+}
+
+// bloat grows the process's live heap by roughly mb megabytes and keeps the
+// allocation reachable for the life of the process, so repeated requests
+// with increasing mb values push memory usage toward the container's limit.
+var heapBallast [][]byte
+
+func bloat(mbParam string) error {
+	mb, err := strconv.Atoi(mbParam)
+	if err != nil {
+		return fmt.Errorf("invalid bloat value %q: %w", mbParam, err)
+	}
+	heapBallast = append(heapBallast, make([]byte, mb*1024*1024))
+	return nil
+}
+
+// burn keeps a CPU core spinning for msParam milliseconds, so a request made
+// under a tight CPU limit visibly takes longer (or gets throttled) rather
+// than returning instantly.
+func burn(msParam string) error {
+	ms, err := strconv.Atoi(msParam)
+	if err != nil {
+		return fmt.Errorf("invalid burn value %q: %w", msParam, err)
+	}
+	deadline := time.Now().Add(time.Duration(ms) * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+	return nil
+}
+
+// fillDisk writes mb megabytes of ephemeral-storage to a scratch file under
+// diskFillDir, accumulating across requests so a sequence of increasing mb
+// values can push usage past the container's ephemeral-storage limit and
+// trigger a kubelet eviction.
+func fillDisk(mbParam string) error {
+	mb, err := strconv.Atoi(mbParam)
+	if err != nil {
+		return fmt.Errorf("invalid disk value %q: %w", mbParam, err)
+	}
+	if err := os.MkdirAll(diskFillDir, 0755); err != nil {
+		return fmt.Errorf("failed to create scratch dir: %w", err)
+	}
+	name := filepath.Join(diskFillDir, fmt.Sprintf("fill-%d", time.Now().UnixNano()))
+	return ioutil.WriteFile(name, make([]byte, mb*1024*1024), 0644)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	pkgTest "knative.dev/pkg/test"
+	"knative.dev/pkg/test/logging"
+	"knative.dev/pkg/test/spoof"
+)
+
+// StressKind identifies which resource a StressAndCheck request exercises on the
+// target test image, via the query parameter the image understands.
+type StressKind string
+
+const (
+	// StressMemory bloats heap usage via the `?bloat=<mb>` handler.
+	StressMemory StressKind = "bloat"
+	// StressCPU burns CPU for a duration via the `?burn=<ms>` handler.
+	StressCPU StressKind = "burn"
+	// StressDisk writes ephemeral-storage via the `?disk=<mb>` handler.
+	StressDisk StressKind = "disk"
+)
+
+// StressAndCheck issues a request against endpoint that asks the test image to
+// consume `magnitude` units of the given kind (MB for StressMemory/StressDisk,
+// milliseconds for StressCPU), and verifies the response matches wantSuccess.
+//
+// It is a generalization of the old per-test `bloatAndCheck` helper so that
+// memory, CPU, and ephemeral-storage enforcement tests can all share the same
+// request/assert plumbing.
+func StressAndCheck(t *logging.TLogger, kubeClient kubernetes.Interface, resolvableDomain bool, endpoint *url.URL, kind StressKind, magnitude int, wantSuccess bool) {
+	expect := "failure"
+	if wantSuccess {
+		expect = "success"
+	}
+	t.V(2).Info("Stressing", "kind", kind, "magnitude", magnitude, "want", expect)
+
+	u, _ := url.Parse(endpoint.String())
+	q := u.Query()
+	q.Set(string(kind), fmt.Sprintf("%d", magnitude))
+	u.RawQuery = q.Encode()
+
+	response, err := sendStressRequest(kubeClient, resolvableDomain, u)
+	if err != nil {
+		t.V(5).Info("Received error from sendStressRequest (may be expected)", "error", err)
+		if wantSuccess {
+			t.Error("Didn't get a response from stressing resource", "kind", kind, "magnitude", magnitude)
+		}
+		return
+	}
+
+	switch {
+	case response.StatusCode == http.StatusOK:
+		if !wantSuccess {
+			t.Error("We shouldn't have got a response from stressing resource", "kind", kind, "magnitude", magnitude)
+		}
+	case response.StatusCode == http.StatusBadRequest:
+		t.Error("Test Issue: Received BadRequest from test app, which probably means the test & test image are not cooperating with each other.")
+	default:
+		// Accept all other StatusCode as failure; different systems could return 404, 502, etc on failure
+		t.V(5).Info("Received non-OK http code from sendStressRequest; interpreting as failure", "StatusCode", response.StatusCode)
+		if wantSuccess {
+			t.Error("Didn't get a good response from stressing resource", "kind", kind, "magnitude", magnitude)
+		}
+	}
+}
+
+func sendStressRequest(kubeClient kubernetes.Interface, resolvableDomain bool, url *url.URL) (*spoof.Response, error) {
+	client, err := pkgTest.NewSpoofingClient(kubeClient, klog.V(4).Infof, url.Hostname(), resolvableDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
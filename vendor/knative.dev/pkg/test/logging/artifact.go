@@ -0,0 +1,202 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Event is one Info/Error/Fatal/Collect record emitted by a TLogger, captured
+// for consumption by an ArtifactSink in addition to the normal zap console
+// output.
+type Event struct {
+	Level   int                    `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// TestRecord is the scoped record for a single Run/subtest: its name path,
+// pass/fail/skip outcome, and every Event logged during its lifetime.
+type TestRecord struct {
+	NamePath string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Skipped  bool          `json:"skipped"`
+	Duration time.Duration `json:"duration"`
+	Events   []Event       `json:"events,omitempty"`
+}
+
+// ArtifactSink consumes completed TestRecords, so CI systems that want JUnit
+// or JSON Lines output don't have to scrape zap console logs.
+type ArtifactSink interface {
+	// Record is called once per Run/subtest, when its function returns.
+	// Subtests that called Parallel have not run to completion by then, and
+	// their outcome is not reflected in the parent's record.
+	Record(TestRecord) error
+	// Close flushes and releases any resources (e.g. open files) held by the sink.
+	Close() error
+}
+
+var (
+	artifactSinksMu sync.Mutex
+	artifactSinks   []ArtifactSink
+)
+
+// RegisterArtifactSink adds sink to the set of sinks that every TLogger's
+// completed subtests are reported to. It is intended to be called from
+// TestMain before tests run.
+func RegisterArtifactSink(sink ArtifactSink) {
+	artifactSinksMu.Lock()
+	defer artifactSinksMu.Unlock()
+	artifactSinks = append(artifactSinks, sink)
+}
+
+func reportToArtifactSinks(rec TestRecord) {
+	artifactSinksMu.Lock()
+	sinks := append([]ArtifactSink(nil), artifactSinks...)
+	artifactSinksMu.Unlock()
+
+	for _, sink := range sinks {
+		if err := sink.Record(rec); err != nil {
+			// Best-effort: a broken artifact sink shouldn't fail the test run.
+			Error("Failed to write test artifact record", "error", err)
+		}
+	}
+}
+
+// CloseArtifactSinks closes every registered sink. Callers (typically
+// TestMain) should defer this once after tests finish running.
+func CloseArtifactSinks() {
+	artifactSinksMu.Lock()
+	sinks := append([]ArtifactSink(nil), artifactSinks...)
+	artifactSinksMu.Unlock()
+
+	for _, sink := range sinks {
+		sink.Close()
+	}
+}
+
+// jsonLinesSink writes one JSON object per TestRecord to path, one per line.
+type jsonLinesSink struct {
+	mu sync.Mutex
+	f  *os.File
+	enc *json.Encoder
+}
+
+// NewJSONLinesSink returns an ArtifactSink that appends one JSON record per
+// completed subtest to the file at path.
+func NewJSONLinesSink(path string) (ArtifactSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *jsonLinesSink) Record(rec TestRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(rec)
+}
+
+func (s *jsonLinesSink) Close() error {
+	return s.f.Close()
+}
+
+// junitSink accumulates TestRecords in memory and writes them out as a single
+// JUnit XML document on Close, since JUnit's <testsuite> wrapper needs the
+// final pass/fail counts up front.
+type junitSink struct {
+	mu      sync.Mutex
+	path    string
+	records []TestRecord
+}
+
+// NewJUnitSink returns an ArtifactSink that writes a JUnit XML report to path
+// when Close is called.
+func NewJUnitSink(path string) ArtifactSink {
+	return &junitSink{path: path}
+}
+
+func (s *junitSink) Record(rec TestRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	return nil
+}
+
+type junitTestCase struct {
+	XMLName   xml.Name `xml:"testcase"`
+	Name      string   `xml:"name,attr"`
+	Time      string   `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{} `xml:"skipped,omitempty"`
+	SystemOut string   `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+func (s *junitSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	suite := junitTestSuite{Name: "knative.dev/pkg/test/logging"}
+	for _, rec := range s.records {
+		tc := junitTestCase{
+			Name: rec.NamePath,
+			// JUnit's time attribute is seconds as a decimal, not Go's
+			// Duration.String() format (e.g. "2m0s").
+			Time:      strconv.FormatFloat(rec.Duration.Seconds(), 'f', 3, 64),
+			SystemOut: spewConfig.Sdump(rec.Events),
+		}
+		suite.Tests++
+		switch {
+		case rec.Skipped:
+			suite.Skipped++
+			tc.Skipped = &struct{}{}
+		case !rec.Passed:
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: "test failed"}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	return enc.Encode(suite)
+}
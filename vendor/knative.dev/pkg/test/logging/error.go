@@ -14,6 +14,11 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
+// Package logging is vendored from knative.dev/pkg. The cause-chain support
+// below (WithCause, Unwrap, causeKey) should be contributed upstream and
+// re-vendored rather than grown here; it's carried locally for now only
+// because this snapshot has no working `go mod vendor` toolchain to pull a
+// new knative.dev/pkg release through.
 package logging
 
 import (
@@ -27,15 +32,24 @@ type StructuredError interface {
 	GetValues() []interface{}
 	//	GetMessage() string
 	WithValues(...interface{}) StructuredError
+	// WithCause attaches an underlying error as this error's cause, so it can
+	// later be recovered via errors.Is/errors.As through Unwrap().
+	WithCause(error) StructuredError
 	DisableValuePrinting()
 	EnableValuePrinting()
-	Unwrap() error // TODO: maybe not have?
+	Unwrap() error
 }
 
+// causeKey is the reserved keysAndValues key used to carry a wrapped cause.
+// It is kept out of the spewed context map by keysAndValuesToSpewedMap since
+// the cause is already rendered separately by Error().
+const causeKey = "cause"
+
 type structuredError struct {
 	msg           string
 	keysAndValues []interface{}
 	print         bool
+	cause         error
 }
 
 func keysAndValuesToSpewedMap(args ...interface{}) map[string]string {
@@ -45,6 +59,10 @@ func keysAndValuesToSpewedMap(args ...interface{}) map[string]string {
 		// there must be a better way
 		key, val := args[i], args[i+1]
 		if keyStr, ok := key.(string); ok {
+			if keyStr == causeKey {
+				i += 2
+				continue
+			}
 			m[keyStr] = spew.Sdump(val)
 		}
 		i += 2
@@ -55,12 +73,16 @@ func keysAndValuesToSpewedMap(args ...interface{}) map[string]string {
 // Implement `error` interface
 func (e structuredError) Error() string {
 	// TODO(coryrc): accept zap.Field entries?
+	msg := e.msg
+	if e.cause != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.cause)
+	}
 	if e.print {
 		// %v for fmt.Sprintf does print keys sorted
-		return fmt.Sprintf("Error: %s\nContext:\n%v", e.msg, keysAndValuesToSpewedMap(e.keysAndValues...))
+		return fmt.Sprintf("Error: %s\nContext:\n%v", msg, keysAndValuesToSpewedMap(e.keysAndValues...))
 		//return fmt.Sprint(e.msg, keysAndValuesToSpewedMap(e.keysAndValues...))
 	} else {
-		return e.msg
+		return msg
 	}
 }
 
@@ -81,20 +103,35 @@ func (e *structuredError) EnableValuePrinting() {
 }
 
 func (e structuredError) Unwrap() error {
-	// TODO: if error key allow unwrap? but might not always want to
-	return nil
+	return e.cause
 }
 
 // Create a StructuredError. Gives a little better logging when given to a TLogger.
+// Passing the reserved "cause" key as one of keysAndValues is equivalent to
+// calling WithCause with its value.
 // TODO(coryrc): theoretical problem if we don't convert them right away and they get mutated
 //   maybe save string representation right away just in case?
 func Error(msg string, keysAndValues ...interface{}) *structuredError {
-	return &structuredError{msg, keysAndValues, true}
+	e := &structuredError{msg: msg, print: true}
+	for i := 0; i < len(keysAndValues)-1; i += 2 {
+		if keysAndValues[i] == causeKey {
+			if cause, ok := keysAndValues[i+1].(error); ok {
+				e.cause = cause
+			}
+		}
+	}
+	e.keysAndValues = keysAndValues
+	return e
 }
 
 func (e *structuredError) WithValues(keysAndValues ...interface{}) StructuredError {
 	newKAV := make([]interface{}, 0, len(keysAndValues)+len(e.keysAndValues))
 	newKAV = append(newKAV, e.keysAndValues...)
 	newKAV = append(newKAV, keysAndValues...)
-	return &structuredError{e.msg, newKAV, e.print}
+	return &structuredError{msg: e.msg, keysAndValues: newKAV, print: e.print, cause: e.cause}
+}
+
+// WithCause returns a copy of e with cause attached as its Unwrap()-able cause.
+func (e *structuredError) WithCause(cause error) StructuredError {
+	return &structuredError{msg: e.msg, keysAndValues: e.keysAndValues, print: e.print, cause: cause}
 }
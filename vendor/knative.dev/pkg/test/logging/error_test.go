@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// registryError is a stand-in for the kind of typed error a container
+// registry client (e.g. go-containerregistry's transport.Error) returns:
+// a structured error with a machine-checkable Code, as opposed to a bare
+// string. It exists so this test can exercise WithCause/Unwrap without
+// this vendor package depending on an unvendored third-party module.
+type registryError struct {
+	Code string
+}
+
+func (e *registryError) Error() string {
+	return fmt.Sprintf("registry error: %s", e.Code)
+}
+
+func TestStructuredErrorUnwrap(t *testing.T) {
+	cause := errors.New("boom")
+	err := Error("something failed").WithCause(cause)
+
+	if got := err.Unwrap(); got != cause {
+		t.Errorf("Unwrap() = %v, want %v", got, cause)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("errors.Is(err, cause) = false, want true")
+	}
+}
+
+func TestStructuredErrorWithCauseKeyword(t *testing.T) {
+	cause := errors.New("boom")
+	err := Error("something failed", "cause", cause, "name", "widget")
+
+	if got := err.Unwrap(); got != cause {
+		t.Errorf("Unwrap() = %v, want %v", got, cause)
+	}
+	// The reserved "cause" key should not show up in the spewed context.
+	if _, ok := keysAndValuesToSpewedMap(err.GetValues()...)[causeKey]; ok {
+		t.Error("expected the reserved cause key to be left out of the spewed context")
+	}
+	if strings.Contains(err.Error(), "widget") == false {
+		t.Error("expected non-cause keys to still be printed")
+	}
+}
+
+func TestStructuredErrorRecoverTypedCause(t *testing.T) {
+	regErr := &registryError{Code: "MANIFEST_UNKNOWN"}
+	err := Error("failed to pull image").WithCause(regErr)
+
+	var got *registryError
+	if !errors.As(error(err), &got) {
+		t.Fatal("errors.As failed to recover the wrapped registryError")
+	}
+	if got.Code != "MANIFEST_UNKNOWN" {
+		t.Errorf("recovered error code = %v, want %v", got.Code, "MANIFEST_UNKNOWN")
+	}
+}
+
+func TestStructuredErrorWithValuesPreservesCause(t *testing.T) {
+	cause := errors.New("boom")
+	err := Error("something failed").WithCause(cause).WithValues("extra", "context")
+
+	if !errors.Is(err, cause) {
+		t.Error("WithValues should preserve the wrapped cause")
+	}
+}
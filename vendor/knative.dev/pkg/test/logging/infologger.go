@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"flag"
+
+	"github.com/davecgh/go-spew/spew"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Verbosity is the default V() level new TLoggers are created with, unless
+// the caller goes through newTLogger with an explicit level. It's a flag so
+// `go test -args -v=3` can turn up logging without code changes.
+var Verbosity int
+
+func init() {
+	flag.IntVar(&Verbosity, "v", 0, "Verbosity level for TLogger.V(n).Info() calls.")
+}
+
+// zapCore, if non-nil, is teed into every TLogger's zaptest core in addition
+// to the per-test writer, e.g. so a test binary can also ship logs to a
+// central collector. Nothing in this package sets it; it's a seam for
+// callers to plug into from an init() or TestMain.
+var zapCore zapcore.Core
+
+// logger is the zap.Logger a TLogger reverts to once CleanUp() has detached
+// it from its *testing.T, so any stray post-test log call doesn't panic.
+var logger = zap.NewNop()
+
+// spewConfig controls how Collect() and the Log/Logf compatibility shims
+// render arbitrary values into Event Fields and system-out text.
+var spewConfig = spew.ConfigState{
+	Indent:                  "  ",
+	DisablePointerAddresses: true,
+	DisableCapacities:       true,
+	SortKeys:                true,
+}
+
+// handleFields converts the alternating key/value pairs used throughout this
+// package into zap.Field entries, the form zap.Logger.Check/Write expect.
+func (o *TLogger) handleFields(keysAndValues []interface{}) []zap.Field {
+	fields := make([]zap.Field, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = spewConfig.Sprint(keysAndValues[i])
+		}
+		fields = append(fields, zap.Any(key, keysAndValues[i+1]))
+	}
+	return fields
+}
+
+// infoLogger implements go-logr's InfoLogger for a single V(n) level,
+// writing through to the owning TLogger's zap.Logger and recording an Event
+// at logrLevel for every Info() call so artifact sinks see it too.
+type infoLogger struct {
+	logrLevel int
+	t         *TLogger
+}
+
+func (i *infoLogger) Enabled() bool {
+	return i.logrLevel <= i.t.level
+}
+
+func (i *infoLogger) Info(msg string, keysAndValues ...interface{}) {
+	if checkedEntry := i.t.l.Check(zap.InfoLevel, msg); checkedEntry != nil {
+		checkedEntry.Write(i.t.handleFields(keysAndValues)...)
+	}
+	i.t.events = append(i.t.events, Event{
+		Level:   i.logrLevel,
+		Message: msg,
+		Fields:  keysAndValuesToFieldMap(keysAndValues),
+	})
+}
+
+// indirectWrite is used by the test.T/test.TLegacy compatibility shims
+// (Log/Logf), which only have a single free-form string to report.
+func (i *infoLogger) indirectWrite(msg string, args ...interface{}) {
+	i.Info(msg, args...)
+}
+
+// disabledInfoLoggerT is the InfoLogger handed back for V(n) calls above the
+// TLogger's configured verbosity: Enabled() is always false and Info() is a
+// no-op, so callers can unconditionally call V(n).Info(...) without guarding
+// on Enabled() themselves.
+type disabledInfoLoggerT struct{}
+
+func (disabledInfoLoggerT) Enabled() bool                                 { return false }
+func (disabledInfoLoggerT) Info(msg string, keysAndValues ...interface{}) {}
+
+var disabledInfoLogger = disabledInfoLoggerT{}
@@ -19,6 +19,7 @@ package logging
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/go-logr/logr"
 	"go.uber.org/zap"
@@ -30,11 +31,25 @@ import (
 //  2. A replacement t.Run() for subtests, which calls a subfunction func(t *TLogger) instead
 //  3. Implement test.T and test.TLegacy for compat reasons
 
+// Event.Level sentinels for events that don't come from a V(n).Info() call,
+// where there's no real verbosity level to report. Info events use their
+// actual V(n) level (always >= 0), so these are negative to stay
+// distinguishable from any of them.
+const (
+	errorEventLevel   = -1
+	collectEventLevel = -2
+)
+
 type TLogger struct {
 	l     *zap.Logger
 	level int
 	t     *testing.T
 	e     map[string][]interface{}
+
+	// events and start back RegisterArtifactSink consumers: they let Run
+	// build a TestRecord for this subtest once it completes.
+	events []Event
+	start  time.Time
 }
 
 func (o *TLogger) V(level int) logr.InfoLogger {
@@ -44,7 +59,7 @@ func (o *TLogger) V(level int) logr.InfoLogger {
 	// Probable solution is to write to t.Log at Info level?
 	if level <= o.level {
 		return &infoLogger{
-			logrLevel: o.level,
+			logrLevel: level,
 			t:         o,
 		}
 	}
@@ -132,6 +147,13 @@ func (o *TLogger) Run(name string, f func(t *TLogger)) {
 		tl := newTLogger(ts, o.level)
 		f(tl)
 		tl.handleCollectedErrors()
+		reportToArtifactSinks(TestRecord{
+			NamePath: ts.Name(),
+			Passed:   !ts.Failed(),
+			Skipped:  ts.Skipped(),
+			Duration: time.Since(tl.start),
+			Events:   tl.events,
+		})
 	}
 	o.t.Run(name, tfunc)
 }
@@ -209,6 +231,20 @@ func (o *TLogger) error(err error, msg string, keysAndValues []interface{}) {
 	if checkedEntry := o.l.Check(zap.ErrorLevel, msg); checkedEntry != nil {
 		checkedEntry.Write(o.handleFields(keysAndValues)...)
 	}
+	o.events = append(o.events, Event{Level: errorEventLevel, Message: msg, Fields: keysAndValuesToFieldMap(keysAndValues)})
+}
+
+func keysAndValuesToFieldMap(keysAndValues []interface{}) map[string]interface{} {
+	if len(keysAndValues) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if key, ok := keysAndValues[i].(string); ok {
+			m[key] = keysAndValues[i+1]
+		}
+	}
+	return m
 }
 
 // Creation and Teardown
@@ -229,7 +265,6 @@ func newTLogger(t *testing.T, verbosity int) *TLogger {
 		core = zapcore.NewTee(
 			zapCore,
 			core,
-			// TODO(coryrc): Open new file (maybe creating JUnit!?) with test output?
 		)
 	}
 	log := zap.New(core).Named(t.Name()).WithOptions(testOptions...)
@@ -238,16 +273,19 @@ func newTLogger(t *testing.T, verbosity int) *TLogger {
 		level: verbosity,
 		t:     t,
 		e:     make(map[string][]interface{}, 0),
+		start: time.Now(),
 	}
 	return &tlogger
 }
 
 func (o *TLogger) cloneWithNewLogger(l *zap.Logger) *TLogger {
 	t := TLogger{
-		l:     l,
-		level: o.level,
-		t:     o.t,
-		e:     o.e,
+		l:      l,
+		level:  o.level,
+		t:      o.t,
+		e:      o.e,
+		events: o.events,
+		start:  o.start,
 	}
 	return &t
 }
@@ -261,6 +299,10 @@ func (o *TLogger) Collect(key string, value interface{}) {
 		list[0] = value
 	}
 	o.e[key] = list
+
+	o.events = append(o.events, Event{Level: collectEventLevel, Message: key, Fields: map[string]interface{}{
+		"value": spewConfig.Sdump(value),
+	}})
 }
 
 func (o *TLogger) handleCollectedErrors() {
@@ -281,6 +323,13 @@ func (o *TLogger) handleCollectedErrors() {
 // Please `defer t.CleanUp()` after invoking NewTLogger()
 func (o *TLogger) CleanUp() {
 	o.handleCollectedErrors()
+	reportToArtifactSinks(TestRecord{
+		NamePath: o.t.Name(),
+		Passed:   !o.t.Failed(),
+		Skipped:  o.t.Skipped(),
+		Duration: time.Since(o.start),
+		Events:   o.events,
+	})
 
 	// Ensure nothing can log to t after test is complete
 	// TODO(coryrc): except .WithName(), etc create a new logger